@@ -2,7 +2,6 @@ package main
 
 import (
 	bpmutilsshared "bpm-utils-shared"
-	"bytes"
 	"fmt"
 	"io"
 	"log"
@@ -29,11 +28,20 @@ var compilationJobs = flag.IntP("jobs", "j", 0, "Set the amount of concurrent pr
 var updateInfo = flag.BoolP("update-info", "u", false, "Update the info.yml file")
 var signPackage = flag.BoolP("sign", "s", false, "Sign package using GPG")
 var yesAll = flag.BoolP("yes", "y", false, "Accept all confirmation prompts")
+var downloadJobs = flag.Int("download-jobs", 0, "Set the amount of download checksums to calculate concurrently when updating the info.yml file")
+var lint = flag.Bool("lint", false, "Validate the info.yml file without creating a package")
+var targetArch = flag.String("arch", "", "Create the source package for the given architecture and only update download checksums of its architecture overrides")
 
 func main() {
 	// Setup flags and help
 	setupFlagsAndHelp("bpm-package <options>", "Generates source BPM package from current directory")
 
+	// Validate info.yml file only
+	if *lint {
+		lintPackageInfo()
+		return
+	}
+
 	// Run checks
 	runChecks()
 
@@ -45,7 +53,21 @@ func main() {
 	}
 
 	if repo := bpmutilsshared.GetRepository(); repo != "" {
-		bpmutilsshared.UpdateDatabases(repo)
+		// Read BPM utils config
+		config, err := bpmutilsshared.ReadBPMUtilsConfig()
+		if err != nil {
+			log.Fatalf("Error: failed to read config: %s", err)
+		}
+
+		// Lock repository
+		defer lockRepository(repo).Unlock()
+
+		err = bpmutilsshared.UpdateDatabases(repo, bpmutilsshared.DatabaseOptions{
+			Workers: config.DatabaseWorkers,
+		})
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
 	}
 }
 
@@ -61,6 +83,37 @@ func runChecks() {
 	}
 }
 
+func lintPackageInfo() {
+	// Read info.yml file
+	pkgInfo, err := bpmutilsshared.ReadPacakgeInfoFromFile("info.yml")
+	if err != nil {
+		log.Fatalf("Error: could not read package info: %s", err)
+	}
+
+	validationErrors := pkgInfo.Validate()
+	if len(validationErrors) == 0 {
+		fmt.Println("No problems found in info.yml")
+		return
+	}
+
+	printValidationErrors(validationErrors)
+	fmt.Printf("%d problem(s) found in info.yml\n", len(validationErrors))
+	os.Exit(1)
+}
+
+func printValidationErrors(validationErrors []bpmutilsshared.ValidationError) {
+	for _, validationError := range validationErrors {
+		fmt.Println(formatValidationError(validationError))
+	}
+}
+
+func formatValidationError(validationError bpmutilsshared.ValidationError) string {
+	if validationError.Line != 0 {
+		return fmt.Sprintf("info.yml:%d: %s: %s", validationError.Line, validationError.Field, validationError.Message)
+	}
+	return fmt.Sprintf("info.yml: %s: %s", validationError.Field, validationError.Message)
+}
+
 func createArchive() string {
 	// Read BPM utils config
 	config, err := bpmutilsshared.ReadBPMUtilsConfig()
@@ -96,55 +149,121 @@ func createArchive() string {
 		log.Fatalf("Error: could not read package info: %s", err)
 	}
 
+	// Warn about problems in package info. Use --lint to fail on them instead
+	for _, validationError := range pkgInfo.Validate() {
+		log.Printf("Warning: %s", formatValidationError(validationError))
+	}
+	if *targetArch != "" && !slices.Contains(bpmutilsshared.KnownArchitectures, *targetArch) {
+		log.Fatalf("Error: unknown architecture (%s)", *targetArch)
+	}
+
 	// Update info.yml file
 	if *updateInfo {
+		// Open source cache
+		sourceCache, err := config.OpenSourceCache()
+		if err != nil {
+			log.Fatalf("Error: could not open source cache: %s", err)
+		}
+
 		// Update download checksums
-		for i, download := range pkgInfo.Downloads {
-			if download.Checksum == "skip" {
-				continue
-			}
+		if *downloadJobs <= 0 {
+			*downloadJobs = config.DownloadWorkers
+		}
+		pkgDir, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Error: could not get working directory: %s", err)
+		}
 
-			download.Checksum, err = download.CalculateChecksum(pkgInfo)
-			if err != nil {
-				log.Fatalf("Could not calculate checksum for download entry %d: %s", i+1, err)
+		// Checksums which were calculated are written to info.yml before failures are reported
+		oldChecksums := getDownloadChecksums(pkgInfo)
+		checksumErr := pkgInfo.UpdateDownloadChecksums(bpmutilsshared.ChecksumOptions{
+			SourceCache:      sourceCache,
+			Jobs:             *downloadJobs,
+			Variables:        readRepositoryEnv(),
+			Arch:             *targetArch,
+			PackageDirectory: pkgDir,
+		})
+
+		// Keep source cache within its size limit
+		if sourceCache != nil && sourceCache.MaxSize > 0 {
+			if _, _, err := sourceCache.Prune(false); err != nil {
+				log.Printf("Warning: could not prune source cache: %s", err)
 			}
-
-			pkgInfo.Downloads[i] = download
 		}
 
-		// Add default maintainer
-		if config.AddDefaultMaintainer {
-			if !slices.Contains(pkgInfo.Maintainers, config.DefaultMaintainer) {
+		// Edit changed fields in place to preserve comments and formatting
+		err = bpmutilsshared.EditPackageInfoFile("info.yml", func(editor *bpmutilsshared.PackageInfoEditor) error {
+			for arch, checksums := range getDownloadChecksums(pkgInfo) {
+				for i, checksum := range checksums {
+					if checksum == oldChecksums[arch][i] {
+						continue
+					}
+					var err error
+					if arch == "" {
+						err = editor.SetDownloadChecksum(i, checksum)
+					} else {
+						err = editor.SetArchDownloadChecksum(arch, i, checksum)
+					}
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			// Add default maintainer
+			if config.AddDefaultMaintainer && !slices.Contains(pkgInfo.Maintainers, config.DefaultMaintainer) {
 				pkgInfo.Maintainers = append(pkgInfo.Maintainers, config.DefaultMaintainer)
+				if err := editor.AddMaintainer(config.DefaultMaintainer); err != nil {
+					return err
+				}
 			}
-		}
 
-		// Save yaml back to file
-		var data bytes.Buffer
-		encoder := yaml.NewEncoder(&data)
-		encoder.SetIndent(2)
-		encoder.Encode(pkgInfo)
+			return nil
+		})
 		if err != nil {
-			log.Fatalf("Could not marshal package info: %s", err)
+			if checksumErr != nil {
+				log.Printf("Error: %s", checksumErr)
+			}
+			log.Fatalf("Error: could not update info.yml: %s", err)
+		}
+		if checksumErr != nil {
+			log.Fatalf("Error: %s", checksumErr)
 		}
+	}
 
-		// Stat info.yml
-		stat, err := os.Stat("info.yml")
+	// Merge architecture overrides for the target architecture into the archived info.yml, as 'bpm compile' does
+	// not read them
+	if *targetArch != "" || len(pkgInfo.ArchOverrides) != 0 {
+		pkgInfo = getArchPackageInfo(pkgInfo)
+		tempDir, err := os.MkdirTemp("", "bpm-package-*")
+		if err != nil {
+			log.Fatalf("Error: could not create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(tempDir)
+		err = writeArchPackageInfo(pkgInfo, path.Join(tempDir, "info.yml"))
 		if err != nil {
-			log.Fatalf("Could not stat info.yml: %s", err)
+			log.Fatalf("Error: could not write package info for architecture (%s): %s", pkgInfo.Arch, err)
 		}
 
-		// Write package info back to file
-		err = os.WriteFile("info.yml", data.Bytes(), stat.Mode().Perm())
+		// Archive merged info.yml instead of the one in the current directory
+		wd, err := os.Getwd()
 		if err != nil {
-			log.Fatalf("Could not write package info to info.yml: %s", err)
+			log.Fatalf("Error: could not get working directory: %s", err)
 		}
+		filesToInclude = slices.Concat([]string{"-C", tempDir, "info.yml", "-C", wd}, slices.DeleteFunc(filesToInclude, func(file string) bool {
+			return file == "info.yml"
+		}))
+	}
+
+	// Lock repository
+	if repo := bpmutilsshared.GetRepository(); repo != "" {
+		defer lockRepository(repo).Unlock()
 	}
 
 	// Remove old package from source dir
 	if repo := bpmutilsshared.GetRepository(); repo != "" {
 		if database, err := bpmutilsshared.ReadDatabase(path.Join(repo, "source/database.bpmdb")); err == nil {
-			if entry, ok := database.Entries[pkgInfo.Name]; ok {
+			for _, entry := range getReplacedEntries(repo, database, pkgInfo) {
 				pkgFilepath := path.Join(repo, "source", entry.Filepath)
 				err := os.Remove(pkgFilepath)
 				if err != nil {
@@ -187,12 +306,7 @@ func createArchive() string {
 
 	// Sign package
 	if *signPackage {
-		cmd := exec.Command("gpg", "--detach-sign", filename)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-
-		err := cmd.Run()
+		err := bpmutilsshared.SignFile(filename, getSigningKey())
 		if err != nil {
 			log.Fatalf("Error: could not sign package: %s", err)
 		}
@@ -208,6 +322,49 @@ func createArchive() string {
 	return absFilepath
 }
 
+// getArchPackageInfo returns the package info with the architecture overrides of the target architecture merged
+// into it. The target architecture is set using --arch and defaults to the package architecture
+func getArchPackageInfo(pkgInfo *bpmutilsshared.PackageInfo) *bpmutilsshared.PackageInfo {
+	arch := pkgInfo.Arch
+	if *targetArch != "" {
+		arch = *targetArch
+	}
+
+	archPkgInfo := pkgInfo.ForArch(arch)
+	archPkgInfo.Arch = arch
+	archPkgInfo.ArchOverrides = nil
+
+	return archPkgInfo
+}
+
+func writeArchPackageInfo(pkgInfo *bpmutilsshared.PackageInfo, filePath string) error {
+	data, err := yaml.Marshal(pkgInfo)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// getDownloadChecksums returns download checksums keyed by architecture override. Checksums of the downloads
+// shared by all architectures use an empty key
+func getDownloadChecksums(pkgInfo *bpmutilsshared.PackageInfo) map[string][]string {
+	checksums := make(map[string][]string)
+	for _, download := range pkgInfo.Downloads {
+		checksums[""] = append(checksums[""], download.Checksum)
+	}
+	for arch, override := range pkgInfo.ArchOverrides {
+		if override == nil {
+			continue
+		}
+		for _, download := range override.Downloads {
+			checksums[arch] = append(checksums[arch], download.Checksum)
+		}
+	}
+
+	return checksums
+}
+
 func compilePackage(archive string) {
 	// Setup compile command
 	args := make([]string, 0)
@@ -233,10 +390,22 @@ func compilePackage(archive string) {
 	args = append(args, "--output-fd=3")
 	args = append(args, archive)
 	cmd := exec.Command("bpm", args...)
+	cmd.Env = os.Environ()
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
+	// Export source cache directory
+	config, err := bpmutilsshared.ReadBPMUtilsConfig()
+	if err != nil {
+		log.Fatalf("Error: failed to read config: %s", err)
+	}
+	if sourceCache, err := config.OpenSourceCache(); err != nil {
+		log.Printf("Warning: could not open source cache: %s", err)
+	} else if sourceCache != nil {
+		cmd.Env = append(cmd.Env, bpmutilsshared.SourceCacheEnv+"="+sourceCache.Directory)
+	}
+
 	// Set output pipe for file descriptor 3
 	cmdOutputReader, cmdOutputWriter, err := os.Pipe()
 	if err != nil {
@@ -258,6 +427,11 @@ func compilePackage(archive string) {
 		log.Fatalf("Error: failed to compile BPM source package: %s", err)
 	}
 
+	// Lock repository
+	if repo := bpmutilsshared.GetRepository(); repo != "" {
+		defer lockRepository(repo).Unlock()
+	}
+
 	// Read cmd output
 	cmdOutputWriter.Close()
 	cmdOutput, err := io.ReadAll(cmdOutputReader)
@@ -274,7 +448,7 @@ func compilePackage(archive string) {
 		if repo := bpmutilsshared.GetRepository(); repo != "" {
 			// Remove old package from binary dir
 			if database, err := bpmutilsshared.ReadDatabase(path.Join(repo, "binary/database.bpmdb")); err == nil {
-				if entry, ok := database.Entries[pkgInfo.Name]; ok {
+				for _, entry := range getReplacedEntries(repo, database, pkgInfo) {
 					pkgFilepath := path.Join(repo, "binary", entry.Filepath)
 					err := os.Remove(pkgFilepath)
 					if err != nil {
@@ -308,13 +482,7 @@ func compilePackage(archive string) {
 	// Sign package
 	if *signPackage {
 		for k, v := range outputPkgs {
-			cmd := exec.Command("gpg", "--detach-sign", v)
-			cmd.Dir = path.Dir(v)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			cmd.Stdin = os.Stdin
-
-			err := cmd.Run()
+			err := bpmutilsshared.SignFile(v, getSigningKey())
 			if err != nil {
 				log.Fatalf("Error: could not sign package (%s) at: %s", k, v)
 			}
@@ -355,6 +523,65 @@ func compilePackage(archive string) {
 	}
 }
 
+func getReplacedEntries(repo string, database *bpmutilsshared.BPMDatabase, pkgInfo *bpmutilsshared.PackageInfo) []bpmutilsshared.BPMDatabaseEntry {
+	// Only replace packages with the same version if all versions are kept
+	if config, err := bpmutilsshared.ReadRepositoryConfig(repo); err == nil && config.KeepAllVersions {
+		entries := make([]bpmutilsshared.BPMDatabaseEntry, 0)
+		for _, entry := range database.GetVersions(pkgInfo.Name) {
+			if entry.PackageInfo.GetFullVersion() == pkgInfo.GetFullVersion() {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	if entry, ok := database.Entries[pkgInfo.Name]; ok {
+		return []bpmutilsshared.BPMDatabaseEntry{entry}
+	}
+	return nil
+}
+
+func readRepositoryEnv() map[string]string {
+	repo := bpmutilsshared.GetRepository()
+	if repo == "" {
+		return nil
+	}
+
+	env, err := bpmutilsshared.ReadRepositoryEnv(repo)
+	if err != nil {
+		log.Fatalf("Error: could not read environment file: %s", err)
+	}
+
+	return env
+}
+
+func lockRepository(repo string) *bpmutilsshared.RepositoryLock {
+	// Reuse lock held by a parent process
+	inheritedPID, _ := strconv.Atoi(os.Getenv(bpmutilsshared.RepositoryLockEnv))
+	lock, err := bpmutilsshared.LockRepository(repo, inheritedPID)
+	if err != nil {
+		log.Fatalf("Error: could not lock repository: %s", err)
+	}
+
+	// Pass lock down to child processes
+	if !lock.Inherited() {
+		os.Setenv(bpmutilsshared.RepositoryLockEnv, strconv.Itoa(os.Getpid()))
+	}
+
+	return lock
+}
+
+func getSigningKey() string {
+	// Use signing key configured in current repository
+	if repo := bpmutilsshared.GetRepository(); repo != "" {
+		if config, err := bpmutilsshared.ReadRepositoryConfig(repo); err == nil {
+			return config.SigningKey
+		}
+	}
+
+	return ""
+}
+
 func setupFlagsAndHelp(usage, desc string) {
 	flag.Usage = func() {
 		fmt.Println("Usage: " + usage)
@@ -3,8 +3,8 @@ package main
 import (
 	bpmutilsshared "bpm-utils-shared"
 	"bufio"
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
@@ -62,7 +62,48 @@ func main() {
 	case "update-db", "u":
 		// Setup flags and help
 		flagset := flag.NewFlagSet("update-db", flag.ExitOnError)
-		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options>", subcommand), "Update update source and binary databases in current repository", os.Args[:1])
+		flagset.BoolP("rebuild", "r", false, "Ignore cached database entries and re-read every package archive")
+		flagset.IntP("jobs", "j", 0, "Set the amount of package archives to read concurrently")
+		flagset.BoolP("sign", "s", false, "Sign databases using GPG")
+		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options>", subcommand), "Update update source and binary databases in current repository", os.Args[2:])
+		currentFlagSet = flagset
+
+		// Get current database
+		repo := bpmutilsshared.GetRepository()
+		if repo == "" {
+			log.Fatal("Error: this command may only be run inside a BPM repository")
+		}
+
+		updateDatabasesFunc(repo)
+	case "verify-db":
+		// Setup flags and help
+		flagset := flag.NewFlagSet("verify-db", flag.ExitOnError)
+		flagset.BoolP("verbose", "v", false, "Show additional information about the current operation")
+		flagset.Bool("strict", false, "Treat unsigned packages as errors")
+		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options>", subcommand), "Verify database and package signatures in current repository", os.Args[2:])
+		currentFlagSet = flagset
+
+		// Get current database
+		repo := bpmutilsshared.GetRepository()
+		if repo == "" {
+			log.Fatal("Error: this command may only be run inside a BPM repository")
+		}
+
+		verifyDatabasesFunc(repo)
+	case "db-diff", "d":
+		// Setup flags and help
+		flagset := flag.NewFlagSet("db-diff", flag.ExitOnError)
+		flagset.Bool("json", false, "Output differences as JSON")
+		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options> <old.bpmdb> <new.bpmdb>", subcommand), "Show differences between two databases", os.Args[2:])
+		currentFlagSet = flagset
+
+		diffDatabasesFunc()
+	case "fsck", "f":
+		// Setup flags and help
+		flagset := flag.NewFlagSet("fsck", flag.ExitOnError)
+		flagset.Bool("fix", false, "Repair problems which can be fixed safely and regenerate databases")
+		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options>", subcommand), "Check repository integrity", os.Args[2:])
+		currentFlagSet = flagset
 
 		// Get current database
 		repo := bpmutilsshared.GetRepository()
@@ -70,7 +111,41 @@ func main() {
 			log.Fatal("Error: this command may only be run inside a BPM repository")
 		}
 
-		bpmutilsshared.UpdateDatabases(repo)
+		checkRepositoryFunc(repo)
+	case "owns", "o":
+		// Setup flags and help
+		flagset := flag.NewFlagSet("owns", flag.ExitOnError)
+		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options> <path...>", subcommand), "Show which binary packages provide the given files", os.Args[2:])
+		currentFlagSet = flagset
+
+		// Get current database
+		repo := bpmutilsshared.GetRepository()
+		if repo == "" {
+			log.Fatal("Error: this command may only be run inside a BPM repository")
+		}
+
+		showFileOwnersFunc(repo)
+	case "files":
+		// Setup flags and help
+		flagset := flag.NewFlagSet("files", flag.ExitOnError)
+		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options> <package>", subcommand), "List files provided by a binary package", os.Args[2:])
+		currentFlagSet = flagset
+
+		// Get current database
+		repo := bpmutilsshared.GetRepository()
+		if repo == "" {
+			log.Fatal("Error: this command may only be run inside a BPM repository")
+		}
+
+		listPackageFilesFunc(repo)
+	case "cache":
+		// Setup flags and help
+		flagset := flag.NewFlagSet("cache", flag.ExitOnError)
+		flagset.Bool("all", false, "Remove every cached file instead of only enforcing the size limit")
+		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options> prune", subcommand), "Manage the local source download cache", os.Args[2:])
+		currentFlagSet = flagset
+
+		sourceCacheFunc()
 	case "list", "l":
 		flagset := flag.NewFlagSet("list", flag.ExitOnError)
 		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options>", subcommand), "List packages", os.Args[:1])
@@ -118,6 +193,7 @@ func main() {
 		flagset.BoolP("verbose", "v", false, "Show additional information about the current operation")
 		flagset.BoolP("modified", "m", true, "Skip non-modified source packages")
 		flagset.BoolP("show-order", "o", false, "Show the order in which all packages will be compiled and exit")
+		flagset.String("arch", bpmutilsshared.HostArchitecture(), "Set the architecture whose overrides are used to resolve dependencies")
 		setupFlagsAndHelp(flagset, fmt.Sprintf("bpm-repo %s <options>", subcommand), "Manage BPM repositories and databases", os.Args[2:])
 		currentFlagSet = flagset
 
@@ -155,12 +231,383 @@ func createRepository(name, description string) {
 	fmt.Println("Repository created successfully!")
 }
 
+func updateDatabasesFunc(repo string) {
+	// Get flags
+	rebuild, _ := currentFlagSet.GetBool("rebuild")
+	jobs, _ := currentFlagSet.GetInt("jobs")
+	sign, _ := currentFlagSet.GetBool("sign")
+
+	// Lock repository
+	defer lockRepository(repo).Unlock()
+
+	// Read BPM utils config
+	config, err := bpmutilsshared.ReadBPMUtilsConfig()
+	if err != nil {
+		log.Fatalf("Error: failed to read config: %s", err)
+	}
+	if jobs <= 0 {
+		jobs = config.DatabaseWorkers
+	}
+
+	err = bpmutilsshared.UpdateDatabases(repo, bpmutilsshared.DatabaseOptions{
+		Rebuild: rebuild,
+		Workers: jobs,
+		Sign:    sign,
+	})
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+}
+
+func verifyDatabasesFunc(repo string) {
+	// Get flags
+	verbose, _ := currentFlagSet.GetBool("verbose")
+	strict, _ := currentFlagSet.GetBool("strict")
+
+	errorCount := 0
+	warningCount := 0
+	for _, dir := range []string{"source", "binary"} {
+		databasePath := path.Join(repo, dir, "database.bpmdb")
+		if _, err := os.Stat(databasePath); err != nil {
+			continue
+		}
+
+		// Verify signatures of all database files clients may download
+		for _, file := range bpmutilsshared.DatabaseFiles() {
+			filePath := path.Join(repo, dir, file)
+			if _, err := os.Stat(filePath); err != nil {
+				continue
+			}
+
+			if _, err := os.Stat(filePath + ".sig"); err != nil {
+				log.Printf("Error: %s database file (%s) is not signed", dir, file)
+				errorCount++
+			} else if err := bpmutilsshared.VerifySignature(filePath, filePath+".sig"); err != nil {
+				log.Printf("Error: %s database file (%s) signature is invalid: %s", dir, file, err)
+				errorCount++
+			} else if verbose {
+				fmt.Printf("%s database file (%s) signature is valid\n", dir, file)
+			}
+		}
+
+		// Read database
+		database, err := bpmutilsshared.ReadDatabase(databasePath)
+		if err != nil {
+			log.Printf("Error: could not read %s database: %s", dir, err)
+			errorCount++
+			continue
+		}
+
+		// Verify package signatures of all kept versions
+		keys := slices.Collect(maps.Keys(database.Entries))
+		sort.Strings(keys)
+		for _, name := range keys {
+			for _, entry := range database.GetVersions(name) {
+				pkg := name
+				if len(database.Versions[name]) > 1 {
+					pkg += " " + entry.PackageInfo.GetFullVersion()
+				}
+				pkgFilepath := path.Join(repo, dir, entry.Filepath)
+
+				// Ensure package archive matches database entry
+				if entry.SHA256 != "" {
+					checksum, err := bpmutilsshared.CalculateFileChecksum(pkgFilepath)
+					if err != nil {
+						log.Printf("Error: could not read package (%s): %s", pkg, err)
+						errorCount++
+						continue
+					} else if checksum != entry.SHA256 {
+						log.Printf("Error: package (%s) does not match its database checksum", pkg)
+						errorCount++
+						continue
+					}
+				}
+
+				// Ensure package is signed
+				if _, err := os.Stat(pkgFilepath + ".sig"); err != nil {
+					if strict {
+						log.Printf("Error: package (%s) is not signed", pkg)
+						errorCount++
+					} else {
+						if verbose {
+							log.Printf("Warning: package (%s) is not signed", pkg)
+						}
+						warningCount++
+					}
+					continue
+				}
+
+				// Ensure package signature matches database entry
+				if entry.Signature != nil {
+					checksum, err := bpmutilsshared.CalculateFileChecksum(pkgFilepath + ".sig")
+					if err != nil || checksum != entry.Signature.SHA256 {
+						log.Printf("Error: package (%s) signature does not match its database checksum", pkg)
+						errorCount++
+						continue
+					}
+				}
+
+				// Verify package signature
+				if err := bpmutilsshared.VerifySignature(pkgFilepath, pkgFilepath+".sig"); err != nil {
+					log.Printf("Error: package (%s) signature is invalid: %s", pkg, err)
+					errorCount++
+				} else if verbose {
+					fmt.Printf("Package (%s) signature is valid\n", pkg)
+				}
+			}
+		}
+	}
+
+	// Print summary
+	fmt.Println("----- Summary -----")
+	fmt.Println("Warnings:", warningCount)
+	fmt.Println("Errors:", errorCount)
+
+	if errorCount != 0 {
+		os.Exit(1)
+	}
+}
+
+func diffDatabasesFunc() {
+	// Get flags
+	outputJson, _ := currentFlagSet.GetBool("json")
+
+	// Get database paths
+	if currentFlagSet.NArg() != 2 {
+		log.Fatalf("Error: two database files are required")
+	}
+
+	// Read databases
+	oldDatabase, err := bpmutilsshared.ReadDatabase(currentFlagSet.Arg(0))
+	if err != nil {
+		log.Fatalf("Error: could not read database (%s): %s", currentFlagSet.Arg(0), err)
+	}
+	newDatabase, err := bpmutilsshared.ReadDatabase(currentFlagSet.Arg(1))
+	if err != nil {
+		log.Fatalf("Error: could not read database (%s): %s", currentFlagSet.Arg(1), err)
+	}
+
+	diff := bpmutilsshared.DiffDatabases(oldDatabase, newDatabase)
+
+	// Print differences as json
+	if outputJson {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			log.Fatalf("Error: could not marshal database differences: %s", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	// Print differences
+	printEntries := func(title string, entries []bpmutilsshared.DatabaseDiffEntry) {
+		if len(entries) == 0 {
+			return
+		}
+
+		fmt.Printf("%s:\n", title)
+		for _, entry := range entries {
+			switch {
+			case entry.OldVersion == "":
+				fmt.Printf("  %s %s\n", entry.Name, entry.NewVersion)
+			case entry.NewVersion == "":
+				fmt.Printf("  %s %s\n", entry.Name, entry.OldVersion)
+			case entry.OldVersion == entry.NewVersion:
+				fmt.Printf("  %s %s\n", entry.Name, entry.NewVersion)
+			default:
+				fmt.Printf("  %s %s -> %s\n", entry.Name, entry.OldVersion, entry.NewVersion)
+			}
+
+			if entry.OldVersion == "" || entry.NewVersion == "" {
+				continue
+			}
+
+			// Print size changes
+			if entry.OldDownloadSize != entry.NewDownloadSize {
+				fmt.Printf("    Download size: %d -> %d bytes\n", entry.OldDownloadSize, entry.NewDownloadSize)
+			}
+			if entry.OldInstalledSize != entry.NewInstalledSize {
+				fmt.Printf("    Installed size: %d -> %d bytes\n", entry.OldInstalledSize, entry.NewInstalledSize)
+			}
+
+			// Print dependency changes
+			keys := slices.Collect(maps.Keys(entry.DependencyChanges))
+			sort.Strings(keys)
+			for _, key := range keys {
+				for _, depend := range entry.DependencyChanges[key].Added {
+					fmt.Printf("    %s: +%s\n", key, depend)
+				}
+				for _, depend := range entry.DependencyChanges[key].Removed {
+					fmt.Printf("    %s: -%s\n", key, depend)
+				}
+			}
+		}
+	}
+	printEntries("Added", diff.Added)
+	printEntries("Removed", diff.Removed)
+	printEntries("Upgraded", diff.Upgraded)
+	printEntries("Downgraded", diff.Downgraded)
+	printEntries("Rebuilt", diff.Rebuilt)
+	printEntries("Changed", diff.Changed)
+}
+
+func checkRepositoryFunc(repo string) {
+	// Get flags
+	fix, _ := currentFlagSet.GetBool("fix")
+
+	// Lock repository
+	if fix {
+		defer lockRepository(repo).Unlock()
+	}
+
+	// Check repository
+	problems, err := bpmutilsshared.CheckRepository(repo)
+	if err != nil {
+		log.Fatalf("Error: could not check repository: %s", err)
+	}
+	for _, problem := range problems {
+		fmt.Printf("[%s] %s\n", problem.Kind, problem.Message)
+	}
+
+	// Repair repository
+	if fix && slices.ContainsFunc(problems, bpmutilsshared.RepositoryProblem.Fixable) {
+		for _, problem := range problems {
+			if problem.Kind != bpmutilsshared.ProblemOrphanedSignature {
+				continue
+			}
+
+			err := os.Remove(path.Join(repo, problem.Directory, problem.Filepath))
+			if err != nil {
+				log.Printf("Warning: could not remove orphaned signature (%s): %s", problem.Filepath, err)
+			}
+		}
+
+		// Regenerate databases
+		err = bpmutilsshared.UpdateDatabases(repo, bpmutilsshared.DatabaseOptions{
+			Rebuild: true,
+		})
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+
+		// Check repository again
+		problems, err = bpmutilsshared.CheckRepository(repo)
+		if err != nil {
+			log.Fatalf("Error: could not check repository: %s", err)
+		}
+		for _, problem := range problems {
+			fmt.Printf("Remaining: [%s] %s\n", problem.Kind, problem.Message)
+		}
+	}
+
+	// Print summary
+	fmt.Println("----- Summary -----")
+	fmt.Println("Problems:", len(problems))
+	fmt.Println("Fixable:", len(slices.DeleteFunc(slices.Clone(problems), func(problem bpmutilsshared.RepositoryProblem) bool {
+		return !problem.Fixable()
+	})))
+
+	if len(problems) != 0 {
+		os.Exit(1)
+	}
+}
+
+func sourceCacheFunc() {
+	// Get flags
+	all, _ := currentFlagSet.GetBool("all")
+
+	if currentFlagSet.NArg() < 1 {
+		log.Fatalf("Error: no cache operation set")
+	} else if currentFlagSet.Arg(0) != "prune" {
+		log.Fatalf("Error: unknown cache operation (%s)", currentFlagSet.Arg(0))
+	}
+
+	// Read BPM utils config
+	config, err := bpmutilsshared.ReadBPMUtilsConfig()
+	if err != nil {
+		log.Fatalf("Error: failed to read config: %s", err)
+	}
+
+	// Open source cache
+	sourceCache, err := config.OpenSourceCache()
+	if err != nil {
+		log.Fatalf("Error: could not open source cache: %s", err)
+	} else if sourceCache == nil {
+		log.Fatalf("Error: no source cache directory has been configured")
+	}
+
+	removedObjects, removedSize, err := sourceCache.Prune(all)
+	if err != nil {
+		log.Fatalf("Error: could not prune source cache: %s", err)
+	}
+
+	fmt.Printf("Removed %d cached file(s) (%.1f MiB)\n", removedObjects, float64(removedSize)/1024/1024)
+}
+
+func readFilesIndex(repo string) *bpmutilsshared.BPMFilesIndex {
+	index, err := bpmutilsshared.ReadFilesIndex(path.Join(repo, "binary/files.bpmdb"))
+	if os.IsNotExist(err) {
+		log.Fatalf("Error: files index does not exist. Set 'files_index: true' in bpm-repo.conf and run 'bpm-repo update-db'")
+	} else if err != nil {
+		log.Fatalf("Error: could not read files index: %s", err)
+	}
+
+	return index
+}
+
+func showFileOwnersFunc(repo string) {
+	if currentFlagSet.NArg() < 1 {
+		log.Fatalf("Error: no file path set")
+	}
+
+	// Read files index
+	index := readFilesIndex(repo)
+
+	found := true
+	for _, filePath := range currentFlagSet.Args() {
+		owners := index.GetOwners(filePath)
+		if len(owners) == 0 {
+			log.Printf("Error: no package provides %s", filePath)
+			found = false
+			continue
+		}
+
+		fmt.Printf("%s is provided by %s\n", filePath, strings.Join(owners, ", "))
+	}
+
+	if !found {
+		os.Exit(1)
+	}
+}
+
+func listPackageFilesFunc(repo string) {
+	if currentFlagSet.NArg() != 1 {
+		log.Fatalf("Error: no package name set")
+	}
+	pkgName := currentFlagSet.Arg(0)
+
+	// Read files index
+	index := readFilesIndex(repo)
+
+	files := index.GetPackageFiles(pkgName)
+	if len(files) == 0 {
+		log.Fatalf("Error: package (%s) does not provide any files", pkgName)
+	}
+
+	for _, file := range files {
+		fmt.Println("/" + file)
+	}
+}
+
 func checkVersionsFunc(repo string) {
 	// Get flags
 	verbose, _ := currentFlagSet.GetBool("verbose")
 	force, _ := currentFlagSet.GetBool("force")
 	apply, _ := currentFlagSet.GetBool("apply")
 
+	// Lock repository
+	defer lockRepository(repo).Unlock()
+
 	// Read environment files
 	err := readEnvFile(repo)
 	if err != nil {
@@ -275,7 +722,7 @@ func checkVersionsFunc(repo string) {
 		}
 
 		// Compare versions
-		if pkgInfo.Version != latestVersion {
+		if bpmutilsshared.CompareVersions(latestVersion, pkgInfo.Version) != 0 {
 			pkgsWithUpdates[pkgInfo.Name] = struct {
 				OldVersion string
 				NewVersion string
@@ -288,13 +735,13 @@ func checkVersionsFunc(repo string) {
 			pkgInfo.Version = latestVersion
 			pkgInfo.Revision = 1
 			if apply && !cachedVersions[pkgInfo.Name].OnHold {
-				var data bytes.Buffer
-				encoder := yaml.NewEncoder(&data)
-				encoder.SetIndent(2)
-				encoder.Encode(pkgInfo)
-
 				// Write package information
-				err := os.WriteFile(path.Join(dir, "info.yml"), data.Bytes(), 0644)
+				err := bpmutilsshared.EditPackageInfoFile(path.Join(dir, "info.yml"), func(editor *bpmutilsshared.PackageInfoEditor) error {
+					if err := editor.SetVersion(latestVersion); err != nil {
+						return err
+					}
+					return editor.SetRevision(1)
+				})
 				if err != nil {
 					log.Printf("Warning: could not write new version for package (%s) to file: %s", pkgInfo.Name, err)
 				}
@@ -317,7 +764,7 @@ func checkVersionsFunc(repo string) {
 	// Save cached versions to file
 	data, err = yaml.Marshal(cachedVersions)
 	if err == nil {
-		err := os.WriteFile(path.Join(repo, ".version-cache"), data, 0644)
+		err := bpmutilsshared.WriteFileAtomic(path.Join(repo, ".version-cache"), data, 0644)
 		if err != nil {
 			log.Printf("Warning: could not write cached versions to file: %s", err)
 		}
@@ -370,6 +817,9 @@ func holdPackage(repo string) {
 	// Get flags
 	get, _ := currentFlagSet.GetBool("get")
 
+	// Lock repository
+	defer lockRepository(repo).Unlock()
+
 	// Get package name
 	pkgName := ""
 	if len(currentFlagSet.Args()) < 1 {
@@ -425,7 +875,7 @@ func holdPackage(repo string) {
 	// Save cached versions to file
 	data, err = yaml.Marshal(cachedVersions)
 	if err == nil {
-		err := os.WriteFile(path.Join(repo, ".version-cache"), data, 0644)
+		err := bpmutilsshared.WriteFileAtomic(path.Join(repo, ".version-cache"), data, 0644)
 		if err != nil {
 			log.Printf("Warning: could not write cached versions to file: %s", err)
 		}
@@ -440,23 +890,22 @@ func holdPackage(repo string) {
 
 func listPackagesFunc(repo string) {
 	// Read package recipes
-	pkgs := bpmutilsshared.ReadRepositoryRecipes(repo)
+	pkgs, err := bpmutilsshared.ReadRepositoryRecipes(repo)
+	if err != nil {
+		log.Fatalf("Error: could not read package recipes: %s", err)
+	}
 
 	// Read databases
 	sourceDatabase, _ := bpmutilsshared.ReadDatabase(path.Join(repo, "source/database.bpmdb"))
 	binaryDatabase, _ := bpmutilsshared.ReadDatabase(path.Join(repo, "binary/database.bpmdb"))
 
 	for _, pkg := range pkgs {
-		fmt.Printf("%s (%s):\n", pkg.Name, pkg.Version)
+		fmt.Printf("%s (%s):\n", pkg.Name, pkg.GetFullVersion())
 
 		// Show source package version
 		if sourceDatabase != nil {
 			if entry, ok := sourceDatabase.Entries[pkg.Name]; ok {
-				if entry.PackageInfo.Version == pkg.Version {
-					fmt.Printf("  Source package: %s\n", entry.PackageInfo.Version)
-				} else {
-					fmt.Printf("  Source package: %s ≠ %s (Version mismatch)\n", entry.PackageInfo.Version, pkg.Version)
-				}
+				printPackageVersion("Source package", entry.PackageInfo, &pkg)
 			} else {
 				fmt.Println("  Source package not found!")
 			}
@@ -465,23 +914,49 @@ func listPackagesFunc(repo string) {
 		// Show binary package version
 		if binaryDatabase != nil {
 			if entry, ok := binaryDatabase.Entries[pkg.Name]; ok {
-				if entry.PackageInfo.Version == pkg.Version {
-					fmt.Printf("  Binary package: %s\n", entry.PackageInfo.Version)
-				} else {
-					fmt.Printf("  Binary package: %s ≠ %s (Version mismatch)\n", entry.PackageInfo.Version, pkg.Version)
-				}
+				printPackageVersion("Binary package", entry.PackageInfo, &pkg)
 			} else {
 				fmt.Println("  Binary package not found!")
 			}
+
+			// Show split package versions
+			for _, splitPkg := range pkg.ResolveSplitPackages() {
+				if entry, ok := binaryDatabase.Entries[splitPkg.Name]; ok {
+					printPackageVersion(fmt.Sprintf("Split package (%s)", splitPkg.Name), entry.PackageInfo, splitPkg)
+				} else {
+					fmt.Printf("  Split package (%s) not found!\n", splitPkg.Name)
+				}
+			}
 		}
 	}
 }
 
+func printPackageVersion(label string, pkgInfo, recipe *bpmutilsshared.PackageInfo) {
+	switch comparison := pkgInfo.GetVersionInfo().Compare(recipe.GetVersionInfo()); {
+	case comparison == 0:
+		fmt.Printf("  %s: %s\n", label, pkgInfo.GetFullVersion())
+	case comparison < 0:
+		fmt.Printf("  %s: %s < %s (Outdated)\n", label, pkgInfo.GetFullVersion(), recipe.GetFullVersion())
+	default:
+		fmt.Printf("  %s: %s > %s (Newer than recipe)\n", label, pkgInfo.GetFullVersion(), recipe.GetFullVersion())
+	}
+}
+
 func compileAllPackagesFunc(repo string) {
 	// Get flags
 	verbose, _ := currentFlagSet.GetBool("verbose")
 	modifiedOnly, _ := currentFlagSet.GetBool("modified")
 	showOrder, _ := currentFlagSet.GetBool("show-order")
+	arch, _ := currentFlagSet.GetString("arch")
+	// Unknown host architectures have no overrides, so only architectures set by the user are validated
+	if currentFlagSet.Changed("arch") && !slices.Contains(bpmutilsshared.KnownArchitectures, arch) {
+		log.Fatalf("Error: unknown architecture (%s)", arch)
+	}
+
+	// Lock repository
+	if !showOrder {
+		defer lockRepository(repo).Unlock()
+	}
 
 	// Read BPM utils config
 	config, err := bpmutilsshared.ReadBPMUtilsConfig()
@@ -490,15 +965,24 @@ func compileAllPackagesFunc(repo string) {
 	}
 
 	// Read package recipes
-	pkgs := bpmutilsshared.ReadRepositoryRecipes(repo)
-	pkgsMap := make(map[string]bpmutilsshared.PackageInfo)
+	pkgs, err := bpmutilsshared.ReadRepositoryRecipes(repo)
+	if err != nil {
+		log.Fatalf("Error: could not read package recipes: %s", err)
+	}
+	for i := range pkgs {
+		pkgs[i] = *pkgs[i].ForArch(arch)
+	}
+	pkgsMap := make(map[string]bpmutilsshared.PackageInfo)       // Recipes providing each package
+	resolvedPkgs := make(map[string]*bpmutilsshared.PackageInfo) // Package infos including resolved split packages
 	for _, pkg := range pkgs {
 		pkgsMap[pkg.Name] = pkg
+		resolvedPkgs[pkg.Name] = &pkg
 
 		// Add split packages
-		for _, splitPkg := range pkg.SplitPackages {
+		for _, splitPkg := range pkg.ResolveSplitPackages() {
 			if _, ok := pkgsMap[splitPkg.Name]; !ok {
 				pkgsMap[splitPkg.Name] = pkg
+				resolvedPkgs[splitPkg.Name] = splitPkg.ForArch(arch)
 			}
 		}
 	}
@@ -525,32 +1009,43 @@ func compileAllPackagesFunc(repo string) {
 		depends = append(depends, pkgInfo.MakeDepends...)
 
 		for _, depend := range depends {
-			dependName, _, _ := bpmutilsshared.SplitPkgNameAndVersion(depend)
+			dependency, err := bpmutilsshared.ParseDependency(depend)
+			if err != nil {
+				return fmt.Errorf("package (%s): %s", pkgInfo.Name, err)
+			}
 
-			// Find package in repository
-			dependInfo, ok := pkgsMap[dependName]
+			// Find first alternative in repository
+			var dependInfo bpmutilsshared.PackageInfo
+			ok := false
+			for _, alternative := range dependency.Alternatives {
+				if dependInfo, ok = pkgsMap[alternative.Name]; ok {
+					break
+				}
+			}
 
 			if !ok {
 				// Search for virtual package
-				for _, pkg := range pkgsMap {
-					if slices.Contains(pkg.Provides, dependName) {
-						dependInfo = pkg
+				for name, pkg := range resolvedPkgs {
+					if slices.ContainsFunc(dependency.Names(), func(provided string) bool { return slices.Contains(pkg.Provides, provided) }) {
+						dependInfo = pkgsMap[name]
 						ok = true
 						break
 					}
 				}
 
 				if !ok {
-					// Try to see if package exists in BPM's other repositories
-					err := exec.Command("bpm", "query", "-d", depend).Run()
-					if err != nil {
+					// Try to see if any alternative exists in BPM's other repositories. Only the name is passed, as bpm
+					// does not understand ranges and architecture qualifiers
+					if !slices.ContainsFunc(dependency.Alternatives, func(alternative bpmutilsshared.DependencyAlternative) bool {
+						return exec.Command("bpm", "query", "-d", alternative.Name).Run() == nil
+					}) {
 						return fmt.Errorf("could not find package (%s) in any database", depend)
 					}
 					continue
 				}
 			}
 
-			err := visit(dependInfo)
+			err = visit(dependInfo)
 			if err != nil {
 				if strings.Contains(err.Error(), "circular") {
 					if verbose {
@@ -570,7 +1065,9 @@ func compileAllPackagesFunc(repo string) {
 
 	for _, pkg := range pkgs {
 		if mark, _ := marked[pkg.Name]; mark != 2 {
-			visit(pkg)
+			if err := visit(pkg); err != nil {
+				log.Fatalf("Error: could not resolve dependencies: %s", err)
+			}
 		}
 	}
 
@@ -582,26 +1079,16 @@ func compileAllPackagesFunc(repo string) {
 			skip = true
 
 			// Check if required version is valid
-			for _, depend := range pkgInfo.Depends {
-				if !strings.ContainsRune(depend, '=') {
+			for _, depend := range slices.Concat(pkgInfo.Depends, pkgInfo.MakeDepends) {
+				dependency, err := bpmutilsshared.ParseDependency(depend)
+				if err != nil || !dependency.HasConstraints() {
 					continue
 				}
 
-				dependName, _, _ := bpmutilsshared.SplitPkgNameAndVersion(depend)
-
-				if !bpmutilsshared.EvaluateDependency(depend, pkgsMap[dependName].Version) {
-					skip = false
-					break
-				}
-			}
-			for _, depend := range pkgInfo.MakeDepends {
-				if !strings.ContainsRune(depend, '=') {
-					continue
-				}
-
-				dependName, _, _ := bpmutilsshared.SplitPkgNameAndVersion(depend)
-
-				if !bpmutilsshared.EvaluateDependency(depend, pkgsMap[dependName].Version) {
+				if !slices.ContainsFunc(dependency.Alternatives, func(alternative bpmutilsshared.DependencyAlternative) bool {
+					dependInfo, ok := resolvedPkgs[alternative.Name]
+					return ok && alternative.MatchesVersion(dependInfo.GetFullVersion())
+				}) {
 					skip = false
 					break
 				}
@@ -637,8 +1124,8 @@ func compileAllPackagesFunc(repo string) {
 			// Check if binary database entry is not synced
 			if binaryDatabase != nil {
 				if len(pkgInfo.SplitPackages) != 0 {
-					for _, splitPkg := range pkgInfo.SplitPackages {
-						if binaryPkgInfo, ok := binaryDatabase.Entries[splitPkg.Name]; !ok || binaryPkgInfo.PackageInfo.GetFullVersion() != pkgInfo.GetFullVersion() {
+					for _, splitPkg := range pkgInfo.ResolveSplitPackages() {
+						if binaryPkgInfo, ok := binaryDatabase.Entries[splitPkg.Name]; !ok || binaryPkgInfo.PackageInfo.GetFullVersion() != splitPkg.GetFullVersion() {
 							skip = false
 							break
 						}
@@ -692,26 +1179,30 @@ func compileAllPackagesFunc(repo string) {
 	}
 }
 
-func readEnvFile(repo string) error {
-	data, err := os.ReadFile(path.Join(repo, ".env"))
-	if os.IsNotExist(err) {
-		return nil
-	} else if err != nil {
-		return err
+func lockRepository(repo string) *bpmutilsshared.RepositoryLock {
+	// Reuse lock held by a parent process
+	inheritedPID, _ := strconv.Atoi(os.Getenv(bpmutilsshared.RepositoryLockEnv))
+	lock, err := bpmutilsshared.LockRepository(repo, inheritedPID)
+	if err != nil {
+		log.Fatalf("Error: could not lock repository: %s", err)
 	}
 
-	for _, line := range strings.Split(string(data), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || line[0] == '#' {
-			continue
-		}
+	// Pass lock down to child processes
+	if !lock.Inherited() {
+		os.Setenv(bpmutilsshared.RepositoryLockEnv, strconv.Itoa(os.Getpid()))
+	}
 
-		splitLine := strings.Split(line, "=")
-		if len(splitLine) != 2 {
-			return fmt.Errorf("invalid format")
-		}
+	return lock
+}
+
+func readEnvFile(repo string) error {
+	env, err := bpmutilsshared.ReadRepositoryEnv(repo)
+	if err != nil {
+		return err
+	}
 
-		os.Setenv(splitLine[0], splitLine[1])
+	for key, value := range env {
+		os.Setenv(key, value)
 	}
 
 	return nil
@@ -723,9 +1214,15 @@ func listSubcommands() {
 	fmt.Println("Subcommands:")
 	fmt.Println("  c, create-repo      Create a new BPM repository")
 	fmt.Println("  u, update-db        Update update source and binary databases in current repositor")
+	fmt.Println("  verify-db           Verify database and package signatures in current repository")
 	fmt.Println("  v, check-versions   Manage BPM repositories and databases")
 	fmt.Println("  h, hold             Prevent package from being automatically updated")
+	fmt.Println("  f, fsck             Check repository integrity")
 	fmt.Println("  l, list             List packages")
+	fmt.Println("  o, owns             Show which binary packages provide the given files")
+	fmt.Println("  files               List files provided by a binary package")
+	fmt.Println("  d, db-diff          Show differences between two databases")
+	fmt.Println("  cache               Manage the local source download cache")
 	fmt.Println("  a, compile-all      Compile all packages in the current repository")
 
 }
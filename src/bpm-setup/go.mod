@@ -10,7 +10,10 @@ require (
 
 require (
 	github.com/drone/envsubst v1.0.3 // indirect
+	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/knqyf263/go-rpm-version v0.0.0-20240918084003-2afd7dc6a38f // indirect
+	golang.org/x/crypto v0.31.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
 
 replace bpm-utils-shared => ../bpm-utils-shared
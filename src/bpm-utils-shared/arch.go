@@ -0,0 +1,58 @@
+package bpm_utils_shared
+
+import (
+	"runtime"
+	"slices"
+)
+
+// ArchOverride holds fields of an 'arch_overrides' entry in info.yml. Lists are appended to the corresponding
+// lists of the package when building for that architecture
+type ArchOverride struct {
+	Depends         []string          `yaml:"depends,omitempty"`
+	RuntimeDepends  []string          `yaml:"runtime_depends,omitempty"`
+	OptionalDepends []string          `yaml:"optional_depends,omitempty"`
+	MakeDepends     []string          `yaml:"make_depends,omitempty"`
+	CheckDepends    []string          `yaml:"check_depends,omitempty"`
+	Conflicts       []string          `yaml:"conflicts,omitempty"`
+	Replaces        []string          `yaml:"replaces,omitempty"`
+	Provides        []string          `yaml:"provides,omitempty"`
+	Downloads       []PackageDownload `yaml:"downloads,omitempty"`
+}
+
+// HostArchitecture returns the architecture of the running system using BPM architecture names
+func HostArchitecture() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	case "386":
+		return "i686"
+	case "arm":
+		return "armv7"
+	default:
+		return runtime.GOARCH
+	}
+}
+
+// ForArch returns a copy of the package info with the overrides for arch merged into it. Merged lists are newly
+// allocated, other fields are shared with the original
+func (pkgInfo *PackageInfo) ForArch(arch string) *PackageInfo {
+	override := pkgInfo.ArchOverrides[arch]
+	if override == nil {
+		override = &ArchOverride{}
+	}
+
+	merged := *pkgInfo
+	merged.Depends = slices.Concat(pkgInfo.Depends, override.Depends)
+	merged.RuntimeDepends = slices.Concat(pkgInfo.RuntimeDepends, override.RuntimeDepends)
+	merged.OptionalDepends = slices.Concat(pkgInfo.OptionalDepends, override.OptionalDepends)
+	merged.MakeDepends = slices.Concat(pkgInfo.MakeDepends, override.MakeDepends)
+	merged.CheckDepends = slices.Concat(pkgInfo.CheckDepends, override.CheckDepends)
+	merged.Conflicts = slices.Concat(pkgInfo.Conflicts, override.Conflicts)
+	merged.Replaces = slices.Concat(pkgInfo.Replaces, override.Replaces)
+	merged.Provides = slices.Concat(pkgInfo.Provides, override.Provides)
+	merged.Downloads = slices.Concat(pkgInfo.Downloads, override.Downloads)
+
+	return &merged
+}
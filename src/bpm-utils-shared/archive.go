@@ -0,0 +1,85 @@
+package bpm_utils_shared
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type PackageArchive struct {
+	PackageInfo *PackageInfo
+	Files       []PackageFileEntry // Nil if the archive does not contain a files.txt file
+	Members     []string
+	ModTime     time.Time // Latest modification time of all archive members
+}
+
+func ReadPackageArchive(path string) (*PackageArchive, error) {
+	// Open archive file
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadPackageArchiveFromReader(file)
+}
+
+func ReadPackageArchiveFromReader(reader io.Reader) (*PackageArchive, error) {
+	archive := &PackageArchive{
+		Members: make([]string, 0),
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		// Clean member name
+		name := strings.TrimPrefix(path.Clean(header.Name), "./")
+		archive.Members = append(archive.Members, name)
+		if header.ModTime.After(archive.ModTime) {
+			archive.ModTime = header.ModTime
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch name {
+		case "info.yml":
+			data, err := io.ReadAll(tarReader)
+			if err != nil {
+				return nil, err
+			}
+
+			archive.PackageInfo, err = ReadPackageInfo(data)
+			if err != nil {
+				return nil, err
+			}
+		case "files.txt":
+			data, err := io.ReadAll(tarReader)
+			if err != nil {
+				return nil, err
+			}
+
+			archive.Files, err = ParseFilesTxt(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if archive.PackageInfo == nil {
+		return nil, fmt.Errorf("archive does not contain an info.yml file")
+	}
+
+	return archive, nil
+}
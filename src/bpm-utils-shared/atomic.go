@@ -0,0 +1,34 @@
+package bpm_utils_shared
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	// Write data to temporary file in the same directory
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// Move temporary file into place
+	return os.Rename(file.Name(), path)
+}
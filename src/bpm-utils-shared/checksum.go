@@ -0,0 +1,109 @@
+package bpm_utils_shared
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+type ChecksumAlgorithm string
+
+const (
+	ChecksumSHA256  ChecksumAlgorithm = "sha256"
+	ChecksumSHA512  ChecksumAlgorithm = "sha512"
+	ChecksumBLAKE2b ChecksumAlgorithm = "blake2b" // BLAKE2b-512, as printed by b2sum
+)
+
+// Checksum is a download checksum written as '<algorithm>:<hex digest>'. Checksums without an algorithm prefix are sha256
+type Checksum struct {
+	Algorithm ChecksumAlgorithm
+	Digest    string
+}
+
+func ParseChecksum(checksum string) (Checksum, error) {
+	algorithm, digest, ok := strings.Cut(checksum, ":")
+	if !ok {
+		algorithm, digest = string(ChecksumSHA256), checksum
+	}
+
+	hash, err := NewChecksumHash(ChecksumAlgorithm(algorithm))
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	// Ensure digest is valid
+	digest = strings.ToLower(digest)
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != hash.Size() {
+		return Checksum{}, fmt.Errorf("invalid %s checksum (%s)", algorithm, digest)
+	}
+
+	return Checksum{Algorithm: ChecksumAlgorithm(algorithm), Digest: digest}, nil
+}
+
+func NewChecksumHash(algorithm ChecksumAlgorithm) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumSHA512:
+		return sha512.New(), nil
+	case ChecksumBLAKE2b:
+		return blake2b.New512(nil)
+	default:
+		return nil, fmt.Errorf("unknown checksum algorithm (%s)", algorithm)
+	}
+}
+
+func (checksum Checksum) String() string {
+	return string(checksum.Algorithm) + ":" + checksum.Digest
+}
+
+// ComputeChecksum hashes all data read from reader using the given algorithm
+func ComputeChecksum(reader io.Reader, algorithm ChecksumAlgorithm) (Checksum, error) {
+	hash, err := NewChecksumHash(algorithm)
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	_, err = io.Copy(hash, reader)
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	return Checksum{Algorithm: algorithm, Digest: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Verify hashes all data read from reader and ensures it matches the checksum
+func (checksum Checksum) Verify(reader io.Reader) error {
+	actual, err := ComputeChecksum(reader, checksum.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	if actual.Digest != checksum.Digest {
+		return fmt.Errorf("checksum mismatch: expected %s but got %s", checksum, actual)
+	}
+
+	return nil
+}
+
+func VerifyFileChecksum(path, checksum string) error {
+	expected, err := ParseChecksum(checksum)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return expected.Verify(file)
+}
@@ -1,22 +1,31 @@
 package bpm_utils_shared
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/fs"
-	"log"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
-	"strconv"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 )
 
+const CurrentDatabaseVersion = 3
+
 type BPMDatabase struct {
 	DatabaseVersion int                         `yaml:"database_version"`
-	Entries         map[string]BPMDatabaseEntry `yaml:"entries"`
+	Entries         map[string]BPMDatabaseEntry `yaml:"entries"` // Latest version of every package
+
+	// Every version of every package sorted from oldest to newest. Only set if all versions are kept
+	Versions map[string][]BPMDatabaseEntry `yaml:"versions,omitempty"`
 }
 
 type BPMDatabaseEntry struct {
@@ -24,6 +33,29 @@ type BPMDatabaseEntry struct {
 	Filepath      string       `yaml:"filepath"`
 	DownloadSize  int64        `yaml:"download_size"`
 	InstalledSize int64        `yaml:"installed_size"`
+
+	// Added in database version 3
+	SHA256         string                `yaml:"sha256,omitempty"`
+	SHA512         string                `yaml:"sha512,omitempty"`
+	Signature      *BPMDatabaseSignature `yaml:"signature,omitempty"`
+	BuildTimestamp int64                 `yaml:"build_timestamp,omitempty"` // Unix time the package was built, see readDatabaseEntry
+}
+
+type BPMDatabaseSignature struct {
+	Filepath string `yaml:"filepath"`
+	SHA256   string `yaml:"sha256"`
+}
+
+func (database *BPMDatabase) GetVersions(pkgName string) []BPMDatabaseEntry {
+	if versions, ok := database.Versions[pkgName]; ok {
+		return versions
+	}
+
+	if entry, ok := database.Entries[pkgName]; ok {
+		return []BPMDatabaseEntry{entry}
+	}
+
+	return nil
 }
 
 func ReadDatabase(path string) (*BPMDatabase, error) {
@@ -33,6 +65,12 @@ func ReadDatabase(path string) (*BPMDatabase, error) {
 		return nil, err
 	}
 
+	// Decompress database if required
+	output, err = decodeDatabase(output)
+	if err != nil {
+		return nil, err
+	}
+
 	database := &BPMDatabase{}
 
 	// Unmarshal yaml
@@ -41,79 +79,374 @@ func ReadDatabase(path string) (*BPMDatabase, error) {
 		return nil, err
 	}
 
+	// Ensure database version is supported
+	if database.DatabaseVersion > CurrentDatabaseVersion {
+		return nil, fmt.Errorf("database version %d is not supported", database.DatabaseVersion)
+	}
+
 	return database, nil
 }
 
-func GenerateDatabase(path string) error {
+type DatabaseOptions struct {
+	Rebuild bool // Ignore cached entries and re-read every package archive
+	Workers int  // Amount of package archives to read concurrently. Defaults to the amount of CPUs
+	SHA512  bool // Include SHA-512 digests alongside SHA-256 digests
+
+	KeepAllVersions bool     // Keep every package version found on disk instead of failing on duplicate packages
+	Formats         []string // Additional database formats to write (gzip, zstd, json)
+	FilesIndex      bool     // Write a files.bpmdb index mapping every file to the packages providing it
+
+	Sign       bool   // Create a detached signature for every written database file
+	SigningKey string // GPG key used for signing. Defaults to the default GPG key
+}
+
+type databaseCache struct {
+	DatabaseVersion int                           `yaml:"database_version"`
+	Entries         map[string]databaseCacheEntry `yaml:"entries"`
+}
+
+type databaseCacheEntry struct {
+	Size          int64            `yaml:"size"`
+	ModTime       int64            `yaml:"mtime"`
+	Entry         BPMDatabaseEntry `yaml:"entry"`
+	FilesRecorded bool             `yaml:"files_recorded,omitempty"`
+	Files         []string         `yaml:"files,omitempty"`
+}
+
+func readDatabaseCache(path string) *databaseCache {
+	cache := &databaseCache{
+		DatabaseVersion: CurrentDatabaseVersion,
+		Entries:         make(map[string]databaseCacheEntry),
+	}
+
+	// Read cache file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+
+	// Unmarshal yaml and discard cache if it is invalid or outdated
+	readCache := &databaseCache{}
+	err = yaml.Unmarshal(data, readCache)
+	if err != nil || readCache.DatabaseVersion != cache.DatabaseVersion || readCache.Entries == nil {
+		return cache
+	}
+
+	return readCache
+}
+
+func CalculateFileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func readDatabaseEntry(packagePath string, withSHA512 bool) (*BPMDatabaseEntry, *PackageArchive, error) {
+	// Open package archive
+	file, err := os.Open(packagePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	// Read package archive while hashing its contents
+	hash256 := sha256.New()
+	hash512 := sha512.New()
+	var reader io.Reader
+	if withSHA512 {
+		reader = io.TeeReader(file, io.MultiWriter(hash256, hash512))
+	} else {
+		reader = io.TeeReader(file, hash256)
+	}
+	archive, err := ReadPackageArchiveFromReader(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, nil, err
+	}
+
+	// Initialize database entry
+	entry := &BPMDatabaseEntry{}
+	entry.PackageInfo = archive.PackageInfo
+	entry.InstalledSize = 0
+	entry.SHA256 = hex.EncodeToString(hash256.Sum(nil))
+	if withSHA512 {
+		entry.SHA512 = hex.EncodeToString(hash512.Sum(nil))
+	}
+	// Use the latest archive member modification time as build timestamp. Source packages are created with all
+	// member times set to 0 to be reproducible, so the modification time of the archive file is used instead
+	if archive.ModTime.Unix() > 0 {
+		entry.BuildTimestamp = archive.ModTime.Unix()
+	} else if stat, err := file.Stat(); err == nil {
+		entry.BuildTimestamp = stat.ModTime().Unix()
+	}
+
+	// Get package installed size
+	if entry.PackageInfo.Type == "binary" {
+		if archive.Files == nil {
+			return nil, nil, fmt.Errorf("binary package does not contain a files.txt file")
+		}
+
+		for _, file := range archive.Files {
+			entry.InstalledSize += file.Size
+		}
+	}
+
+	return entry, archive, nil
+}
+
+func readDatabaseSignature(path, relPath string) (*BPMDatabaseSignature, error) {
+	signaturePath := filepath.Join(path, relPath+".sig")
+	if _, err := os.Stat(signaturePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	checksum, err := CalculateFileChecksum(signaturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BPMDatabaseSignature{
+		Filepath: relPath + ".sig",
+		SHA256:   checksum,
+	}, nil
+}
+
+func loadDatabaseCacheEntry(cache *databaseCache, path, relPath string, info fs.FileInfo, options DatabaseOptions) (databaseCacheEntry, error) {
+	packagePath := filepath.Join(path, relPath)
+
+	// Reuse cached entry if the package archive has not changed
+	cacheEntry, ok := cache.Entries[relPath]
+	if ok && (cacheEntry.Size != info.Size() || options.SHA512 && cacheEntry.Entry.SHA512 == "" || options.FilesIndex && !cacheEntry.FilesRecorded) {
+		ok = false
+	} else if ok && cacheEntry.ModTime != info.ModTime().UnixNano() {
+		// Archive was modified but may still have the same contents
+		checksum, err := CalculateFileChecksum(packagePath)
+		if err != nil {
+			return databaseCacheEntry{}, err
+		}
+		ok = checksum == cacheEntry.Entry.SHA256
+	}
+
+	if !ok {
+		entry, archive, err := readDatabaseEntry(packagePath, options.SHA512)
+		if err != nil {
+			return databaseCacheEntry{}, fmt.Errorf("could not read package (%s): %s", relPath, err)
+		}
+
+		cacheEntry = databaseCacheEntry{
+			Entry: *entry,
+		}
+
+		// Record package files for the files index
+		if options.FilesIndex {
+			cacheEntry.FilesRecorded = true
+			for _, file := range archive.Files {
+				if file.Type != FileTypeDirectory {
+					cacheEntry.Files = append(cacheEntry.Files, file.Path)
+				}
+			}
+		}
+	}
+
+	cacheEntry.Size = info.Size()
+	cacheEntry.ModTime = info.ModTime().UnixNano()
+
+	// Signatures may change without the package archive changing
+	signature, err := readDatabaseSignature(path, relPath)
+	if err != nil {
+		return databaseCacheEntry{}, fmt.Errorf("could not read package signature (%s): %s", relPath+".sig", err)
+	}
+	cacheEntry.Entry.Signature = signature
+
+	return cacheEntry, nil
+}
+
+func writeDatabaseFile(path string, data []byte, options DatabaseOptions) error {
+	err := WriteFileAtomic(path, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Sign database file
+	if options.Sign {
+		err = SignFile(path, options.SigningKey)
+		if err != nil {
+			return fmt.Errorf("could not sign database file (%s): %s", path, err)
+		}
+		return nil
+	}
+
+	// Remove outdated signature
+	err = os.Remove(path + ".sig")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func GenerateDatabase(path string, options DatabaseOptions) error {
 	database := BPMDatabase{
-		DatabaseVersion: 2,
+		DatabaseVersion: CurrentDatabaseVersion,
 		Entries:         make(map[string]BPMDatabaseEntry),
 	}
+	if options.KeepAllVersions {
+		database.Versions = make(map[string][]BPMDatabaseEntry)
+	}
 
-	err := filepath.Walk(path, func(packagePath string, info fs.FileInfo, err error) error {
-		if !strings.HasSuffix(packagePath, ".bpm") {
-			return nil
-		}
+	// Read database cache
+	cachePath := filepath.Join(path, ".database-cache")
+	oldCache := &databaseCache{}
+	if !options.Rebuild {
+		oldCache = readDatabaseCache(cachePath)
+	}
+	newCache := databaseCache{
+		DatabaseVersion: database.DatabaseVersion,
+		Entries:         make(map[string]databaseCacheEntry),
+	}
 
-		// Initialize database entry
-		entry := BPMDatabaseEntry{}
-		entry.DownloadSize = info.Size()
-		entry.InstalledSize = 0
-		entry.Filepath, err = filepath.Rel(path, packagePath)
+	// Find all package archives
+	type packageFile struct {
+		relPath string
+		info    fs.FileInfo
+	}
+	packageFiles := make([]packageFile, 0)
+	err := filepath.Walk(path, func(packagePath string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if info.IsDir() || !strings.HasSuffix(packagePath, ".bpm") {
+			return nil
+		}
 
-		// Get package info
-		entry.PackageInfo, err = ReadPacakgeInfoFromTarball(packagePath)
+		relPath, err := filepath.Rel(path, packagePath)
 		if err != nil {
 			return err
 		}
+		packageFiles = append(packageFiles, packageFile{relPath, info})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		// Get package installed size
-		if entry.PackageInfo.Type == "binary" {
-			cmd := exec.Command("tar", "xf", packagePath, "files.txt", "-O")
-			output, err := cmd.Output()
-			if err != nil {
-				return err
+	// Read package archives using a bounded worker pool
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	cacheEntries := make([]databaseCacheEntry, len(packageFiles))
+	errs := make([]error, len(packageFiles))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(packageFiles)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				cacheEntries[i], errs[i] = loadDatabaseCacheEntry(oldCache, path, packageFiles[i].relPath, packageFiles[i].info, options)
 			}
+		}()
+	}
+	for i := range packageFiles {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-			for _, line := range strings.Split(string(output), "\n") {
-				line = strings.TrimSpace(line)
-				if line == "" {
-					continue
-				}
-				stringEntry := strings.Split(line, " ")
-				if len(stringEntry) < 5 {
-					return fmt.Errorf("files.txt is not formatted correctly")
-				}
-				size, err := strconv.ParseInt(stringEntry[len(stringEntry)-1], 10, 64)
-				if err != nil {
-					return err
-				}
+	// Add entries to database in path order so the output does not depend on completion order
+	for i, packageFile := range packageFiles {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		cacheEntry := cacheEntries[i]
 
-				entry.InstalledSize += size
-			}
+		// Initialize database entry
+		entry := cacheEntry.Entry
+		entry.DownloadSize = packageFile.info.Size()
+		entry.Filepath = packageFile.relPath
+		if !options.SHA512 {
+			entry.SHA512 = ""
 		}
 
 		// Add entry to database
-		if _, ok := database.Entries[entry.PackageInfo.Name]; ok {
-			return fmt.Errorf("package (%s) has already been added to the database", entry.PackageInfo.Name)
+		if options.KeepAllVersions {
+			versions := database.Versions[entry.PackageInfo.Name]
+			if slices.ContainsFunc(versions, func(e BPMDatabaseEntry) bool {
+				return e.PackageInfo.GetFullVersion() == entry.PackageInfo.GetFullVersion()
+			}) {
+				return fmt.Errorf("package (%s) version (%s) has already been added to the database", entry.PackageInfo.Name, entry.PackageInfo.GetFullVersion())
+			}
+			database.Versions[entry.PackageInfo.Name] = append(versions, entry)
+		} else {
+			if _, ok := database.Entries[entry.PackageInfo.Name]; ok {
+				return fmt.Errorf("package (%s) has already been added to the database", entry.PackageInfo.Name)
+			}
+			database.Entries[entry.PackageInfo.Name] = entry
 		}
-		database.Entries[entry.PackageInfo.Name] = entry
 
-		return nil
-	})
+		// Add entry to new cache
+		cacheEntry.Entry = entry
+		if !options.FilesIndex {
+			cacheEntry.FilesRecorded = false
+			cacheEntry.Files = nil
+		}
+		newCache.Entries[packageFile.relPath] = cacheEntry
+	}
+
+	// Sort package versions and point entries to latest versions
+	for name, versions := range database.Versions {
+		slices.SortFunc(versions, func(a, b BPMDatabaseEntry) int {
+			return a.PackageInfo.GetVersionInfo().Compare(b.PackageInfo.GetVersionInfo())
+		})
+		database.Entries[name] = versions[len(versions)-1]
+	}
+
+	data, err := yaml.Marshal(&database)
 	if err != nil {
 		return err
 	}
 
-	data, err := yaml.Marshal(&database)
+	err = writeDatabaseFile(filepath.Join(path, "database.bpmdb"), data, options)
 	if err != nil {
 		return err
 	}
 
-	err = os.WriteFile(filepath.Join(path, "database.bpmdb"), data, 0644)
+	// Write additional database formats
+	err = writeDatabaseFormats(path, data, options)
+	if err != nil {
+		return err
+	}
+
+	// Write files index
+	if options.FilesIndex {
+		err = writeFilesIndex(path, &database, &newCache, options)
+	} else {
+		err = removeFilesIndex(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Save database cache
+	data, err = yaml.Marshal(&newCache)
+	if err != nil {
+		return err
+	}
+
+	err = WriteFileAtomic(cachePath, data, 0644)
 	if err != nil {
 		return err
 	}
@@ -121,20 +454,38 @@ func GenerateDatabase(path string) error {
 	return nil
 }
 
-func UpdateDatabases(repo string) {
+func UpdateDatabases(repo string, options DatabaseOptions) error {
+	// Read repository config
+	config, err := ReadRepositoryConfig(repo)
+	if err != nil {
+		return fmt.Errorf("could not read repository config: %s", err)
+	}
+	options.SHA512 = options.SHA512 || config.DatabaseSHA512
+	options.KeepAllVersions = options.KeepAllVersions || config.KeepAllVersions
+	options.FilesIndex = options.FilesIndex || config.FilesIndex
+	if options.Formats == nil {
+		options.Formats = config.DatabaseFormats
+	}
+	options.Sign = options.Sign || config.SignDatabases
+	if options.SigningKey == "" {
+		options.SigningKey = config.SigningKey
+	}
+
 	if _, err := os.Stat(path.Join(repo, "source")); err == nil {
-		err = GenerateDatabase(path.Join(repo, "source"))
+		err = GenerateDatabase(path.Join(repo, "source"), options)
 		if err != nil {
-			log.Fatalf("Error: could not generate source directory database: %s", err)
+			return fmt.Errorf("could not generate source directory database: %s", err)
 		}
-		fmt.Println("Source directory database was generated successfully!")
+		logger.Infof("Source directory database was generated successfully!")
 	}
 
 	if _, err := os.Stat(path.Join(repo, "binary")); err == nil {
-		err = GenerateDatabase(path.Join(repo, "binary"))
+		err = GenerateDatabase(path.Join(repo, "binary"), options)
 		if err != nil {
-			log.Fatalf("Error: could not generate binary directory database: %s", err)
+			return fmt.Errorf("could not generate binary directory database: %s", err)
 		}
-		fmt.Println("Binary directory database was generated successfully!")
+		logger.Infof("Binary directory database was generated successfully!")
 	}
+
+	return nil
 }
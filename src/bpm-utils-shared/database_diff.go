@@ -0,0 +1,139 @@
+package bpm_utils_shared
+
+import (
+	"maps"
+	"slices"
+	"sort"
+)
+
+type DatabaseDiff struct {
+	Added      []DatabaseDiffEntry `json:"added"`
+	Removed    []DatabaseDiffEntry `json:"removed"`
+	Upgraded   []DatabaseDiffEntry `json:"upgraded"`
+	Downgraded []DatabaseDiffEntry `json:"downgraded"`
+	Rebuilt    []DatabaseDiffEntry `json:"rebuilt"`
+	Changed    []DatabaseDiffEntry `json:"changed"` // Same version but different sizes or dependencies
+}
+
+type DatabaseDiffEntry struct {
+	Name       string `json:"name"`
+	OldVersion string `json:"old_version,omitempty"`
+	NewVersion string `json:"new_version,omitempty"`
+
+	OldDownloadSize  int64 `json:"old_download_size,omitempty"`
+	NewDownloadSize  int64 `json:"new_download_size,omitempty"`
+	OldInstalledSize int64 `json:"old_installed_size,omitempty"`
+	NewInstalledSize int64 `json:"new_installed_size,omitempty"`
+
+	DependencyChanges map[string]DependencyListDiff `json:"dependency_changes,omitempty"`
+}
+
+type DependencyListDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func (entry *DatabaseDiffEntry) SizeChanged() bool {
+	return entry.OldDownloadSize != entry.NewDownloadSize || entry.OldInstalledSize != entry.NewInstalledSize
+}
+
+func DiffDatabases(oldDatabase, newDatabase *BPMDatabase) *DatabaseDiff {
+	diff := &DatabaseDiff{
+		Added:      make([]DatabaseDiffEntry, 0),
+		Removed:    make([]DatabaseDiffEntry, 0),
+		Upgraded:   make([]DatabaseDiffEntry, 0),
+		Downgraded: make([]DatabaseDiffEntry, 0),
+		Rebuilt:    make([]DatabaseDiffEntry, 0),
+		Changed:    make([]DatabaseDiffEntry, 0),
+	}
+
+	// Collect package names from both databases
+	names := slices.Collect(maps.Keys(oldDatabase.Entries))
+	for name := range newDatabase.Entries {
+		if _, ok := oldDatabase.Entries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldEntry, inOld := oldDatabase.Entries[name]
+		newEntry, inNew := newDatabase.Entries[name]
+
+		diffEntry := DatabaseDiffEntry{Name: name}
+		if inOld {
+			diffEntry.OldVersion = oldEntry.PackageInfo.GetFullVersion()
+			diffEntry.OldDownloadSize = oldEntry.DownloadSize
+			diffEntry.OldInstalledSize = oldEntry.InstalledSize
+		}
+		if inNew {
+			diffEntry.NewVersion = newEntry.PackageInfo.GetFullVersion()
+			diffEntry.NewDownloadSize = newEntry.DownloadSize
+			diffEntry.NewInstalledSize = newEntry.InstalledSize
+		}
+
+		if !inOld {
+			diff.Added = append(diff.Added, diffEntry)
+			continue
+		} else if !inNew {
+			diff.Removed = append(diff.Removed, diffEntry)
+			continue
+		}
+
+		diffEntry.DependencyChanges = diffDependencyLists(oldEntry.PackageInfo, newEntry.PackageInfo)
+
+		// Compare versions without revisions so revision-only changes count as rebuilds
+		newVersion := newEntry.PackageInfo.GetVersionInfo()
+		newVersion.Revision = 0
+		switch comparison := newVersion.Compare(oldEntry.PackageInfo.GetVersionInfo()); {
+		case comparison > 0:
+			diff.Upgraded = append(diff.Upgraded, diffEntry)
+		case comparison < 0:
+			diff.Downgraded = append(diff.Downgraded, diffEntry)
+		case newEntry.PackageInfo.Revision != oldEntry.PackageInfo.Revision:
+			diff.Rebuilt = append(diff.Rebuilt, diffEntry)
+		case diffEntry.SizeChanged() || len(diffEntry.DependencyChanges) != 0:
+			diff.Changed = append(diff.Changed, diffEntry)
+		}
+	}
+
+	return diff
+}
+
+func diffDependencyLists(oldInfo, newInfo *PackageInfo) map[string]DependencyListDiff {
+	changes := make(map[string]DependencyListDiff)
+
+	lists := []struct {
+		name     string
+		old, new []string
+	}{
+		{"depends", oldInfo.Depends, newInfo.Depends},
+		{"runtime_depends", oldInfo.RuntimeDepends, newInfo.RuntimeDepends},
+		{"optional_depends", oldInfo.OptionalDepends, newInfo.OptionalDepends},
+		{"make_depends", oldInfo.MakeDepends, newInfo.MakeDepends},
+		{"check_depends", oldInfo.CheckDepends, newInfo.CheckDepends},
+	}
+
+	for _, list := range lists {
+		listDiff := DependencyListDiff{}
+		for _, depend := range list.new {
+			if !slices.Contains(list.old, depend) {
+				listDiff.Added = append(listDiff.Added, depend)
+			}
+		}
+		for _, depend := range list.old {
+			if !slices.Contains(list.new, depend) {
+				listDiff.Removed = append(listDiff.Removed, depend)
+			}
+		}
+
+		if len(listDiff.Added) != 0 || len(listDiff.Removed) != 0 {
+			changes[list.name] = listDiff
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
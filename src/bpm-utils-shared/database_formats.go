@@ -0,0 +1,132 @@
+package bpm_utils_shared
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/klauspost/compress/zstd"
+	"gopkg.in/yaml.v3"
+)
+
+// Additional database formats written next to database.bpmdb
+var databaseFormats = map[string]string{
+	"gzip": "database.bpmdb.gz",
+	"zstd": "database.bpmdb.zst",
+	"json": "database.json",
+}
+
+// DatabaseFiles returns the names of all database files which may be written to and signed in a repository directory
+func DatabaseFiles() []string {
+	files := []string{"database.bpmdb"}
+	for _, format := range slices.Sorted(maps.Keys(databaseFormats)) {
+		files = append(files, databaseFormats[format])
+	}
+
+	return append(files, "files.bpmdb")
+}
+
+func encodeDatabase(format string, data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	switch format {
+	case "gzip":
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	case "zstd":
+		writer, err := zstd.NewWriter(&buffer)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	case "json":
+		// Convert yaml to json while keeping the same schema
+		var value any
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		jsonData, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(jsonData)
+	default:
+		return nil, fmt.Errorf("unknown database format (%s)", format)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func decodeDatabase(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+	case bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		reader, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+	default:
+		// Plain yaml or json, which is parsed as yaml
+		return data, nil
+	}
+}
+
+func writeDatabaseFormats(path string, data []byte, options DatabaseOptions) error {
+	for _, format := range options.Formats {
+		if _, ok := databaseFormats[format]; !ok {
+			return fmt.Errorf("unknown database format (%s)", format)
+		}
+	}
+
+	for format, filename := range databaseFormats {
+		formatPath := filepath.Join(path, filename)
+
+		// Remove formats which are no longer requested
+		if !slices.Contains(options.Formats, format) {
+			for _, file := range []string{formatPath, formatPath + ".sig"} {
+				if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			continue
+		}
+
+		encoded, err := encodeDatabase(format, data)
+		if err != nil {
+			return err
+		}
+
+		err = writeDatabaseFile(formatPath, encoded, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
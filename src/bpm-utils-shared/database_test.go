@@ -0,0 +1,173 @@
+package bpm_utils_shared
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestPackage writes a binary package archive containing a single file to path
+func writeTestPackage(t *testing.T, path, name, version string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	members := []struct {
+		name string
+		data string
+	}{
+		{"info.yml", "name: " + name + "\nversion: \"" + version + "\"\narchitecture: any\ntype: binary\n"},
+		{"files.txt", "usr/bin/" + name + " 0 0 755 1024\n"},
+	}
+	writer := tar.NewWriter(file)
+	for _, member := range members {
+		header := &tar.Header{
+			Name:    member.name,
+			Mode:    0644,
+			Size:    int64(len(member.data)),
+			ModTime: time.Unix(1700000000, 0),
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(member.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDatabaseCacheEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(t *testing.T, packagePath string, cacheEntry *databaseCacheEntry)
+		options    DatabaseOptions
+		wantReused bool
+	}{
+		{
+			name:       "unchanged",
+			modify:     func(t *testing.T, packagePath string, cacheEntry *databaseCacheEntry) {},
+			wantReused: true,
+		},
+		{
+			name: "size changed",
+			modify: func(t *testing.T, packagePath string, cacheEntry *databaseCacheEntry) {
+				cacheEntry.Size++
+			},
+		},
+		{
+			name: "mtime changed",
+			modify: func(t *testing.T, packagePath string, cacheEntry *databaseCacheEntry) {
+				modTime := time.Unix(0, cacheEntry.ModTime).Add(time.Hour)
+				if err := os.Chtimes(packagePath, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantReused: true,
+		},
+		{
+			name: "mtime and hash changed",
+			modify: func(t *testing.T, packagePath string, cacheEntry *databaseCacheEntry) {
+				cacheEntry.ModTime--
+				cacheEntry.Entry.SHA256 = "0000000000000000000000000000000000000000000000000000000000000000"
+			},
+		},
+		{
+			name: "hash changed",
+			modify: func(t *testing.T, packagePath string, cacheEntry *databaseCacheEntry) {
+				// The hash is only checked if the modification time changed
+				cacheEntry.Entry.SHA256 = "0000000000000000000000000000000000000000000000000000000000000000"
+			},
+			wantReused: true,
+		},
+		{
+			name:    "sha512 missing",
+			modify:  func(t *testing.T, packagePath string, cacheEntry *databaseCacheEntry) {},
+			options: DatabaseOptions{SHA512: true},
+		},
+		{
+			name:    "files not recorded",
+			modify:  func(t *testing.T, packagePath string, cacheEntry *databaseCacheEntry) {},
+			options: DatabaseOptions{FilesIndex: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := t.TempDir()
+			packagePath := filepath.Join(repo, "foo.bpm")
+			writeTestPackage(t, packagePath, "foo", "1.0")
+
+			info, err := os.Stat(packagePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cacheEntry, err := loadDatabaseCacheEntry(&databaseCache{}, repo, "foo.bpm", info, DatabaseOptions{})
+			if err != nil {
+				t.Fatalf("loadDatabaseCacheEntry() error = %s", err)
+			}
+
+			// Mark cached entry to tell whether it was reused
+			cacheEntry.Entry.InstalledSize = -1
+			test.modify(t, packagePath, &cacheEntry)
+			cache := &databaseCache{Entries: map[string]databaseCacheEntry{"foo.bpm": cacheEntry}}
+
+			info, err = os.Stat(packagePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadDatabaseCacheEntry(cache, repo, "foo.bpm", info, test.options)
+			if err != nil {
+				t.Fatalf("loadDatabaseCacheEntry() error = %s", err)
+			}
+
+			if reused := got.Entry.InstalledSize == -1; reused != test.wantReused {
+				t.Errorf("loadDatabaseCacheEntry() reused cached entry = %t, want %t", reused, test.wantReused)
+			}
+			if got.Size != info.Size() || got.ModTime != info.ModTime().UnixNano() {
+				t.Errorf("loadDatabaseCacheEntry() size, mtime = %d, %d, want %d, %d", got.Size, got.ModTime, info.Size(), info.ModTime().UnixNano())
+			}
+		})
+	}
+}
+
+func TestGenerateDatabaseWorkers(t *testing.T) {
+	repo := t.TempDir()
+	for i := range 16 {
+		name := fmt.Sprintf("pkg%02d", i)
+		writeTestPackage(t, filepath.Join(repo, fmt.Sprintf("dir%d", i%3), name+".bpm"), name, "1.0")
+	}
+
+	var want []byte
+	for _, workers := range []int{1, 2, 8, 32} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			err := GenerateDatabase(repo, DatabaseOptions{Rebuild: true, Workers: workers, SHA512: true})
+			if err != nil {
+				t.Fatalf("GenerateDatabase() error = %s", err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(repo, "database.bpmdb"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want == nil {
+				want = got
+			} else if !bytes.Equal(got, want) {
+				t.Errorf("database.bpmdb generated with %d workers differs from database generated with 1 worker", workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var dependencyArchRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// Comparison operators in the order they are matched
+var versionOperators = []string{">=", "<=", ">", "<", "="}
+
+// Dependency is a parsed dependency expression. Expressions are formatted as one or more alternatives separated
+// by '|'. Each alternative is a package name, an optional ':<architecture>' qualifier and optional comma-separated
+// version constraints, for example 'foo>=1.2,<2|bar:x86_64'
+type Dependency struct {
+	Alternatives []DependencyAlternative
+}
+
+type DependencyAlternative struct {
+	Name        string
+	Arch        string // Architecture the package must be built for, empty for any
+	Constraints []VersionConstraint
+}
+
+type VersionConstraint struct {
+	Operator string // One of >=, <=, >, < or =
+	Version  string // Formatted as '[epoch:]version[-revision]'. May end with '*' to match version prefixes when using '='
+}
+
+func ParseDependency(dependency string) (Dependency, error) {
+	if strings.TrimSpace(dependency) == "" {
+		return Dependency{}, fmt.Errorf("dependency cannot be empty")
+	}
+	if strings.ContainsAny(dependency, " \t") {
+		return Dependency{}, fmt.Errorf("dependency (%s) cannot contain whitespace", dependency)
+	}
+
+	parsed := Dependency{}
+	for _, alternative := range strings.Split(dependency, "|") {
+		parsedAlternative, err := parseDependencyAlternative(alternative)
+		if err != nil {
+			return Dependency{}, fmt.Errorf("invalid dependency (%s): %s", dependency, err)
+		}
+		parsed.Alternatives = append(parsed.Alternatives, parsedAlternative)
+	}
+
+	return parsed, nil
+}
+
+func parseDependencyAlternative(alternative string) (DependencyAlternative, error) {
+	// Split package name from constraints
+	nameEnd := strings.IndexAny(alternative, "<>=")
+	if nameEnd == -1 {
+		nameEnd = len(alternative)
+	}
+	name, arch, hasArch := strings.Cut(alternative[:nameEnd], ":")
+
+	if !packageNameRegex.MatchString(name) {
+		return DependencyAlternative{}, fmt.Errorf("invalid package name (%s)", name)
+	}
+	if hasArch && !dependencyArchRegex.MatchString(arch) {
+		return DependencyAlternative{}, fmt.Errorf("invalid architecture (%s)", arch)
+	}
+
+	parsed := DependencyAlternative{Name: name, Arch: arch}
+	if nameEnd == len(alternative) {
+		return parsed, nil
+	}
+
+	// Parse version constraints
+	for _, constraint := range strings.Split(alternative[nameEnd:], ",") {
+		operator := ""
+		for _, op := range versionOperators {
+			if strings.HasPrefix(constraint, op) {
+				operator = op
+				break
+			}
+		}
+		if operator == "" {
+			return DependencyAlternative{}, fmt.Errorf("missing comparison operator in constraint (%s)", constraint)
+		}
+
+		version := strings.TrimPrefix(constraint, operator)
+		if version == "" {
+			return DependencyAlternative{}, fmt.Errorf("missing version after '%s'", operator)
+		}
+		if strings.ContainsAny(version, "<>=|") {
+			return DependencyAlternative{}, fmt.Errorf("invalid version (%s)", version)
+		}
+		if strings.Contains(version, "*") {
+			if operator != "=" || strings.Index(version, "*") != len(version)-1 {
+				return DependencyAlternative{}, fmt.Errorf("wildcards are only allowed at the end of '=' constraints")
+			}
+		} else if _, err := ParseFullVersion(version); err != nil {
+			return DependencyAlternative{}, err
+		}
+
+		parsed.Constraints = append(parsed.Constraints, VersionConstraint{Operator: operator, Version: version})
+	}
+
+	return parsed, nil
+}
+
+func (dependency Dependency) String() string {
+	alternatives := make([]string, len(dependency.Alternatives))
+	for i, alternative := range dependency.Alternatives {
+		alternatives[i] = alternative.String()
+	}
+
+	return strings.Join(alternatives, "|")
+}
+
+func (alternative DependencyAlternative) String() string {
+	str := alternative.Name
+	if alternative.Arch != "" {
+		str += ":" + alternative.Arch
+	}
+	for i, constraint := range alternative.Constraints {
+		if i != 0 {
+			str += ","
+		}
+		str += constraint.String()
+	}
+
+	return str
+}
+
+func (constraint VersionConstraint) String() string {
+	return constraint.Operator + constraint.Version
+}
+
+// Names returns the package names of all alternatives
+func (dependency Dependency) Names() []string {
+	names := make([]string, 0, len(dependency.Alternatives))
+	for _, alternative := range dependency.Alternatives {
+		if !slices.Contains(names, alternative.Name) {
+			names = append(names, alternative.Name)
+		}
+	}
+
+	return names
+}
+
+// HasConstraints reports whether any alternative restricts the version of its package
+func (dependency Dependency) HasConstraints() bool {
+	return slices.ContainsFunc(dependency.Alternatives, func(alternative DependencyAlternative) bool {
+		return len(alternative.Constraints) != 0
+	})
+}
+
+// Matches reports whether a package with the given name, full version and architecture satisfies any alternative.
+// An empty arch matches any architecture qualifier
+func (dependency Dependency) Matches(name, version, arch string) bool {
+	return slices.ContainsFunc(dependency.Alternatives, func(alternative DependencyAlternative) bool {
+		return alternative.Matches(name, version, arch)
+	})
+}
+
+func (alternative DependencyAlternative) Matches(name, version, arch string) bool {
+	if alternative.Name != name {
+		return false
+	}
+	if alternative.Arch != "" && arch != "" && arch != "any" && alternative.Arch != arch {
+		return false
+	}
+
+	return alternative.MatchesVersion(version)
+}
+
+// MatchesVersion reports whether version satisfies every constraint of the alternative
+func (alternative DependencyAlternative) MatchesVersion(version string) bool {
+	for _, constraint := range alternative.Constraints {
+		if !constraint.Matches(version) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Matches reports whether a version formatted as '[epoch:]version[-revision]' satisfies the constraint. Revisions
+// are only compared if the constraint specifies one
+func (constraint VersionConstraint) Matches(version string) bool {
+	if prefix, ok := strings.CutSuffix(constraint.Version, "*"); ok && constraint.Operator == "=" {
+		// Match prefix against the bare version unless it includes an epoch
+		if parsed, err := ParseFullVersion(version); err == nil && !strings.Contains(prefix, ":") {
+			version = parsed.Version
+		}
+		return strings.HasPrefix(version, prefix)
+	}
+
+	comparison := CompareFullVersions(version, constraint.Version)
+	switch constraint.Operator {
+	case ">=":
+		return comparison >= 0
+	case ">":
+		return comparison > 0
+	case "<=":
+		return comparison <= 0
+	case "<":
+		return comparison < 0
+	case "=":
+		return comparison == 0
+	default:
+		return false
+	}
+}
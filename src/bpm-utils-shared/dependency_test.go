@@ -0,0 +1,151 @@
+package bpm_utils_shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDependency(t *testing.T) {
+	tests := []struct {
+		dependency string
+		want       Dependency
+	}{
+		{
+			dependency: "foo",
+			want:       Dependency{Alternatives: []DependencyAlternative{{Name: "foo"}}},
+		},
+		{
+			dependency: "foo>=1.2",
+			want: Dependency{Alternatives: []DependencyAlternative{
+				{Name: "foo", Constraints: []VersionConstraint{{">=", "1.2"}}},
+			}},
+		},
+		{
+			dependency: "foo>=1.2,<2",
+			want: Dependency{Alternatives: []DependencyAlternative{
+				{Name: "foo", Constraints: []VersionConstraint{{">=", "1.2"}, {"<", "2"}}},
+			}},
+		},
+		{
+			dependency: "foo>1:1.2-3,<=1:2.0",
+			want: Dependency{Alternatives: []DependencyAlternative{
+				{Name: "foo", Constraints: []VersionConstraint{{">", "1:1.2-3"}, {"<=", "1:2.0"}}},
+			}},
+		},
+		{
+			dependency: "foo|bar",
+			want: Dependency{Alternatives: []DependencyAlternative{
+				{Name: "foo"},
+				{Name: "bar"},
+			}},
+		},
+		{
+			dependency: "foo:x86_64",
+			want:       Dependency{Alternatives: []DependencyAlternative{{Name: "foo", Arch: "x86_64"}}},
+		},
+		{
+			dependency: "foo:aarch64>=1.2,<2|bar=3|baz:x86_64",
+			want: Dependency{Alternatives: []DependencyAlternative{
+				{Name: "foo", Arch: "aarch64", Constraints: []VersionConstraint{{">=", "1.2"}, {"<", "2"}}},
+				{Name: "bar", Constraints: []VersionConstraint{{"=", "3"}}},
+				{Name: "baz", Arch: "x86_64"},
+			}},
+		},
+		{
+			dependency: "foo=1.2*",
+			want: Dependency{Alternatives: []DependencyAlternative{
+				{Name: "foo", Constraints: []VersionConstraint{{"=", "1.2*"}}},
+			}},
+		},
+		{
+			dependency: "lib32-foo++=1.2.3",
+			want: Dependency{Alternatives: []DependencyAlternative{
+				{Name: "lib32-foo++", Constraints: []VersionConstraint{{"=", "1.2.3"}}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dependency, func(t *testing.T) {
+			got, err := ParseDependency(test.dependency)
+			if err != nil {
+				t.Fatalf("ParseDependency() error = %s", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseDependency() = %+v, want %+v", got, test.want)
+			}
+			if str := got.String(); str != test.dependency {
+				t.Errorf("String() = %s, want %s", str, test.dependency)
+			}
+		})
+	}
+}
+
+func TestParseDependencyErrors(t *testing.T) {
+	for _, dependency := range []string{
+		"",
+		" ",
+		"foo >=1.2",
+		"foo|",
+		"|foo",
+		"-foo",
+		"foo:",
+		"foo:x86-64",
+		"foo>=",
+		"foo=>1.2",
+		"foo>=1.2,",
+		"foo>=1.2,,<2",
+		"foo>=1.2*",
+		"foo=1*.2",
+		"foo>=1.2-x",
+		"foo>=x:1.2",
+		"foo>=1.2|bar<",
+	} {
+		t.Run(dependency, func(t *testing.T) {
+			if got, err := ParseDependency(dependency); err == nil {
+				t.Errorf("ParseDependency() = %+v, want error", got)
+			}
+		})
+	}
+}
+
+func TestDependencyMatches(t *testing.T) {
+	tests := []struct {
+		dependency string
+		name       string
+		version    string
+		arch       string
+		want       bool
+	}{
+		{"foo", "foo", "1.0-1", "x86_64", true},
+		{"foo", "bar", "1.0-1", "x86_64", false},
+		{"foo>=1.2,<2", "foo", "1.5-1", "", true},
+		{"foo>=1.2,<2", "foo", "2.0-1", "", false},
+		{"foo>=1.2,<2", "foo", "1.1-1", "", false},
+		{"foo>=1.2-3", "foo", "1.2-2", "", false},
+		{"foo>=1.2-3", "foo", "1.2-3", "", true},
+		{"foo=1.2", "foo", "1.2-5", "", true},
+		{"foo<1:1.0", "foo", "2.0-1", "", true},
+		{"foo=1.2*", "foo", "1.2.4-1", "", true},
+		{"foo=1.2*", "foo", "1.3-1", "", false},
+		{"foo=1:1.2*", "foo", "1:1.2.4-1", "", true},
+		{"foo:x86_64", "foo", "1.0-1", "x86_64", true},
+		{"foo:x86_64", "foo", "1.0-1", "aarch64", false},
+		{"foo:x86_64", "foo", "1.0-1", "any", true},
+		{"foo:x86_64", "foo", "1.0-1", "", true},
+		{"foo<1|bar", "bar", "5.0-1", "", true},
+		{"foo<1|bar", "foo", "5.0-1", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dependency+" "+test.name+" "+test.version+" "+test.arch, func(t *testing.T) {
+			dependency, err := ParseDependency(test.dependency)
+			if err != nil {
+				t.Fatalf("ParseDependency() error = %s", err)
+			}
+			if got := dependency.Matches(test.name, test.version, test.arch); got != test.want {
+				t.Errorf("Matches() = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package bpm_utils_shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Download settings used when fetching package sources. DownloadTimeout limits connecting, waiting for a response
+// and waiting for more data, but not the duration of the whole download, so large files on slow links succeed
+var (
+	DownloadRetries      = 3
+	DownloadMaxRedirects = 10
+	DownloadTimeout      = 60 * time.Second
+)
+
+type httpStatusError struct {
+	statusCode int
+	status     string
+}
+
+func (err *httpStatusError) Error() string {
+	return fmt.Sprintf("server returned %s", err.status)
+}
+
+// temporary reports whether the request may succeed if retried
+func (err *httpStatusError) temporary() bool {
+	return err.statusCode == http.StatusTooManyRequests || err.statusCode >= 500
+}
+
+var downloadClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= DownloadMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", DownloadMaxRedirects)
+		}
+		return nil
+	},
+}
+
+// DownloadSchemes lists the url schemes supported by DownloadURL. ftp and ftps urls are downloaded using curl
+var DownloadSchemes = []string{"http", "https", "ftp", "ftps", "file"}
+
+// DownloadURL fetches a URL and passes its contents to consume. Failed attempts are retried, so consume may be
+// called more than once and must discard data from previous calls
+func DownloadURL(downloadUrl string, consume func(io.Reader) error) error {
+	parsedUrl, err := url.Parse(downloadUrl)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(DownloadSchemes, parsedUrl.Scheme) {
+		return fmt.Errorf("unsupported url scheme (%s)", parsedUrl.Scheme)
+	}
+
+	// Local files do not need to be retried
+	if parsedUrl.Scheme == "file" {
+		file, err := os.Open(parsedUrl.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return consume(file)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if parsedUrl.Scheme == "ftp" || parsedUrl.Scheme == "ftps" {
+			err = curlDownloadAttempt(downloadUrl, consume)
+		} else {
+			err = downloadAttempt(downloadUrl, consume)
+		}
+		if err == nil {
+			return nil
+		}
+
+		// Do not retry requests which will fail again
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && !statusErr.temporary() {
+			return err
+		}
+		if attempt >= DownloadRetries {
+			return err
+		}
+
+		logger.Warnf("download of %s failed, retrying: %s", downloadUrl, err)
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+}
+
+func downloadAttempt(downloadUrl string, consume func(io.Reader) error) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: DownloadTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = DownloadTimeout
+	transport.ResponseHeaderTimeout = DownloadTimeout
+	client := *downloadClient
+	client.Transport = transport
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "bpm-utils")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{statusCode: resp.StatusCode, status: resp.Status}
+	}
+
+	// Cancel the request if no data is received for too long
+	body := &idleTimeoutReader{reader: resp.Body, timeout: DownloadTimeout}
+	body.timer = time.AfterFunc(DownloadTimeout, func() {
+		body.timedOut.Store(true)
+		cancel()
+	})
+	defer body.timer.Stop()
+
+	err = consume(body)
+	if body.timedOut.Load() {
+		return fmt.Errorf("no data received for %s", DownloadTimeout)
+	}
+	return err
+}
+
+// idleTimeoutReader restarts timer after every read, so it only fires once reads stall
+type idleTimeoutReader struct {
+	reader   io.Reader
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func (reader *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	if n > 0 {
+		reader.timer.Reset(reader.timeout)
+	}
+	return n, err
+}
+
+func curlDownloadAttempt(downloadUrl string, consume func(io.Reader) error) error {
+	// Abort stalled transfers instead of limiting the duration of the whole download
+	timeout := strconv.Itoa(int(DownloadTimeout.Seconds()))
+	cmd := exec.Command("curl", "--fail", "--silent", "--show-error", "--location", "--connect-timeout", timeout,
+		"--speed-limit", "1", "--speed-time", timeout, "--", downloadUrl)
+	cmd.Stderr = CommandStderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	// Drain remaining output so curl does not block if consume stops reading early
+	consumeErr := consume(stdout)
+	io.Copy(io.Discard, stdout)
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("curl failed: %w", err)
+	}
+
+	return consumeErr
+}
+
+// DownloadChecksum downloads a URL and calculates its checksum using the given algorithm
+func DownloadChecksum(downloadUrl string, algorithm ChecksumAlgorithm) (Checksum, error) {
+	var checksum Checksum
+	err := DownloadURL(downloadUrl, func(reader io.Reader) (err error) {
+		checksum, err = ComputeChecksum(reader, algorithm)
+		return err
+	})
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	return checksum, nil
+}
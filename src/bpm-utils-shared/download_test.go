@@ -0,0 +1,63 @@
+package bpm_utils_shared
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloadURLTimeout(t *testing.T) {
+	oldTimeout, oldRetries := DownloadTimeout, DownloadRetries
+	DownloadTimeout, DownloadRetries = 200*time.Millisecond, 0
+	defer func() {
+		DownloadTimeout, DownloadRetries = oldTimeout, oldRetries
+	}()
+
+	tests := []struct {
+		name    string
+		chunks  int
+		delay   time.Duration
+		wantErr bool
+	}{
+		// Slow downloads taking longer than the timeout succeed as long as data keeps arriving
+		{name: "slow download", chunks: 8, delay: 50 * time.Millisecond},
+		{name: "stalled download", chunks: 2, delay: 400 * time.Millisecond, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for range test.chunks {
+					w.Write([]byte("data"))
+					w.(http.Flusher).Flush()
+					select {
+					case <-time.After(test.delay):
+					case <-r.Context().Done():
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			var data []byte
+			err := DownloadURL(server.URL, func(reader io.Reader) (err error) {
+				data, err = io.ReadAll(reader)
+				return err
+			})
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("DownloadURL() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadURL() error = %s", err)
+			}
+			if len(data) != test.chunks*4 {
+				t.Errorf("DownloadURL() read %d bytes, want %d", len(data), test.chunks*4)
+			}
+		})
+	}
+}
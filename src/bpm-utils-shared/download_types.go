@@ -0,0 +1,270 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// downloadType implements checksum calculation and validation for a value of the 'type' field of downloads
+type downloadType interface {
+	// validate returns the field and error of the first problem with a download of this type, if any
+	validate(download PackageDownload) (string, error)
+	// calculateChecksum returns the new checksum of a download with expanded variables. existingChecksum is the
+	// checksum currently set in info.yml
+	calculateChecksum(download PackageDownload, existingChecksum string, options ChecksumOptions) (string, error)
+}
+
+var downloadTypes = map[string]downloadType{
+	"":      fileDownloadType{},
+	"file":  fileDownloadType{},
+	"local": localDownloadType{},
+	"git":   gitDownloadType{},
+	"hg":    hgDownloadType{},
+	"svn":   svnDownloadType{},
+}
+
+func getDownloadType(name string) (downloadType, error) {
+	if downloadType, ok := downloadTypes[name]; ok {
+		return downloadType, nil
+	}
+
+	return nil, fmt.Errorf("unknown download type (%s)", name)
+}
+
+// fileDownloadType downloads files from urls with a scheme listed in DownloadSchemes
+type fileDownloadType struct{}
+
+func (fileDownloadType) validate(download PackageDownload) (string, error) {
+	for _, downloadUrl := range slices.Concat([]string{download.Url}, download.Mirrors) {
+		// Skip urls which depend on variables
+		if strings.Contains(downloadUrl, "$") {
+			continue
+		}
+		parsedUrl, err := url.Parse(downloadUrl)
+		if err != nil {
+			return "url", fmt.Errorf("invalid url (%s): %s", downloadUrl, err)
+		}
+		if !slices.Contains(DownloadSchemes, parsedUrl.Scheme) {
+			return "url", fmt.Errorf("unsupported url scheme (%s) in url (%s)", parsedUrl.Scheme, downloadUrl)
+		}
+	}
+
+	return "", nil
+}
+
+func (fileDownloadType) calculateChecksum(download PackageDownload, existingChecksum string, options ChecksumOptions) (string, error) {
+	logger.Infof("Downloading and calculating checksum for file (%s)...", download.Url)
+
+	algorithm := checksumAlgorithmOf(existingChecksum)
+	if options.SourceCache == nil {
+		checksum, err := DownloadChecksum(download.Url, algorithm)
+		if err != nil {
+			return "", err
+		}
+		return formatChecksum(checksum, existingChecksum), nil
+	}
+
+	// Calculate checksum of cached file. Cached files which do not match the existing checksum are downloaded
+	// again, as they may be corrupted or the upstream file may have changed
+	cachedPath, ok := options.SourceCache.Lookup(download.Url)
+	if ok && !isPlaceholderChecksum(existingChecksum) {
+		if err := VerifyFileChecksum(cachedPath, existingChecksum); err != nil {
+			logger.Warnf("cached file of (%s) does not match existing checksum, downloading again: %s", download.Url, err)
+			ok = false
+		}
+	}
+	if !ok {
+		var err error
+		cachedPath, err = options.SourceCache.Download(download.Url)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fileChecksum(cachedPath, existingChecksum)
+}
+
+// localDownloadType uses files from the source-files directory of the package or from the repository. Relative
+// paths are resolved against the package directory
+type localDownloadType struct{}
+
+func (localDownloadType) validate(download PackageDownload) (string, error) {
+	if filepath.IsAbs(download.Url) || strings.Contains(download.Url, "://") {
+		return "url", fmt.Errorf("local download paths must be relative to the package directory")
+	}
+
+	return "", nil
+}
+
+func (localDownloadType) calculateChecksum(download PackageDownload, existingChecksum string, options ChecksumOptions) (string, error) {
+	logger.Infof("Calculating checksum for local file (%s)...", download.Url)
+
+	if options.PackageDirectory == "" {
+		return "", fmt.Errorf("package directory is required to calculate checksums of local downloads")
+	}
+	pkgDir, err := filepath.Abs(options.PackageDirectory)
+	if err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(pkgDir, download.Url)
+
+	// Ensure file is inside the source-files directory or repository
+	allowedDirs := []string{filepath.Join(pkgDir, "source-files")}
+	if repo := FindRepository(pkgDir); repo != "" {
+		allowedDirs = append(allowedDirs, repo)
+	}
+	for _, dir := range allowedDirs {
+		rel, err := filepath.Rel(dir, filePath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return fileChecksum(filePath, existingChecksum)
+		}
+	}
+
+	return "", fmt.Errorf("local file (%s) is not inside the source-files directory or repository", download.Url)
+}
+
+// gitDownloadType pins git repositories to the commit of a branch or tag
+type gitDownloadType struct{}
+
+func (gitDownloadType) validate(download PackageDownload) (string, error) {
+	if download.GitBranch == "" {
+		return "git_branch", fmt.Errorf("git downloads require a git branch")
+	}
+
+	return "", nil
+}
+
+func (gitDownloadType) calculateChecksum(download PackageDownload, existingChecksum string, options ChecksumOptions) (string, error) {
+	logger.Infof("Calculating checksum for git branch (%s)...", download.Url)
+
+	if download.GitBranch == "" {
+		return "", fmt.Errorf("'git_branch' field cannot be empty")
+	}
+
+	cmd := exec.Command("git", "ls-remote", "--heads", "--tags", "--", download.Url)
+	cmd.Stderr = CommandStderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	// Find commit of branch or tag, preferring the commit a tag points to
+	checksum := ""
+	for _, line := range strings.Split(string(output), "\n") {
+		commit, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		ref = strings.TrimSuffix(ref, "^{}")
+		if strings.HasPrefix(ref, "refs/") && strings.HasSuffix(ref, "/"+download.GitBranch) {
+			checksum = commit
+		}
+	}
+	if checksum == "" {
+		return "", fmt.Errorf("could not find git branch or tag (%s)", download.GitBranch)
+	}
+
+	return checksum, nil
+}
+
+// hgDownloadType pins Mercurial repositories to the changeset of a branch, bookmark or tag
+type hgDownloadType struct{}
+
+func (hgDownloadType) validate(download PackageDownload) (string, error) {
+	return "", nil
+}
+
+func (hgDownloadType) calculateChecksum(download PackageDownload, existingChecksum string, options ChecksumOptions) (string, error) {
+	logger.Infof("Calculating checksum for Mercurial repository (%s)...", download.Url)
+
+	revision := download.HgBranch
+	if revision == "" {
+		revision = "default"
+	}
+
+	cmd := exec.Command("hg", "identify", "--debug", "--id", "--rev", revision, "--", download.Url)
+	cmd.Stderr = CommandStderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	changeset := strings.TrimSpace(string(output))
+	if changeset == "" {
+		return "", fmt.Errorf("could not find Mercurial revision (%s)", revision)
+	}
+
+	return changeset, nil
+}
+
+// svnDownloadType pins Subversion urls to the revision they were last changed in
+type svnDownloadType struct{}
+
+func (svnDownloadType) validate(download PackageDownload) (string, error) {
+	return "", nil
+}
+
+func (svnDownloadType) calculateChecksum(download PackageDownload, existingChecksum string, options ChecksumOptions) (string, error) {
+	logger.Infof("Calculating checksum for Subversion repository (%s)...", download.Url)
+
+	cmd := exec.Command("svn", "info", "--non-interactive", "--show-item", "last-changed-revision", "--", download.Url)
+	cmd.Stderr = CommandStderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	revision := strings.TrimSpace(string(output))
+	if revision == "" {
+		return "", fmt.Errorf("could not find Subversion revision of (%s)", download.Url)
+	}
+
+	return revision, nil
+}
+
+// isPlaceholderChecksum reports whether a checksum has not been calculated yet, like the 'replaceme' checksum
+// written by bpm-setup, or is set to 'skip'
+func isPlaceholderChecksum(checksum string) bool {
+	return checksum == "" || checksum == "skip" || checksum == "replaceme"
+}
+
+// checksumAlgorithmOf returns the algorithm of an existing checksum, keeping it when checksums are recalculated
+func checksumAlgorithmOf(existingChecksum string) ChecksumAlgorithm {
+	if prefix, _, ok := strings.Cut(existingChecksum, ":"); ok {
+		return ChecksumAlgorithm(prefix)
+	}
+
+	return ChecksumSHA256
+}
+
+// formatChecksum formats a checksum like the existing checksum. Plain sha256 checksums are written without a prefix
+func formatChecksum(checksum Checksum, existingChecksum string) string {
+	if checksum.Algorithm == ChecksumSHA256 && !strings.Contains(existingChecksum, ":") {
+		return checksum.Digest
+	}
+
+	return checksum.String()
+}
+
+func fileChecksum(filePath, existingChecksum string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	checksum, err := ComputeChecksum(file, checksumAlgorithmOf(existingChecksum))
+	if err != nil {
+		return "", err
+	}
+
+	return formatChecksum(checksum, existingChecksum), nil
+}
@@ -0,0 +1,121 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+type PackageFileType string
+
+const (
+	FileTypeRegular   PackageFileType = "regular"
+	FileTypeDirectory PackageFileType = "directory"
+	FileTypeSymlink   PackageFileType = "symlink"
+	FileTypeOther     PackageFileType = "other"
+)
+
+// Unix file type bits which may be included in the mode field
+const (
+	unixTypeMask    = 0170000
+	unixTypeDir     = 0040000
+	unixTypeRegular = 0100000
+	unixTypeSymlink = 0120000
+)
+
+// PackageFileEntry describes a single line of a files.txt file. Lines are formatted as
+// '<path>[ -> <link target>] <uid> <gid> <octal mode> <size>', and paths may contain spaces
+type PackageFileEntry struct {
+	Path       string
+	Type       PackageFileType
+	Mode       fs.FileMode // Permission bits
+	UserID     int
+	GroupID    int
+	Size       int64
+	LinkTarget string
+}
+
+func ParseFilesTxt(data []byte) ([]PackageFileEntry, error) {
+	files := make([]PackageFileEntry, 0)
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		entry, err := ParsePackageFileEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("files.txt line %d: %s", i+1, err)
+		}
+		files = append(files, *entry)
+	}
+
+	return files, nil
+}
+
+func ParsePackageFileEntry(line string) (*PackageFileEntry, error) {
+	line = strings.TrimRight(line, " \t\r")
+
+	// Split numeric fields from the end of the line so paths may contain spaces
+	fields := make([]string, 4)
+	for i := len(fields) - 1; i >= 0; i-- {
+		index := strings.LastIndexByte(line, ' ')
+		if index <= 0 {
+			return nil, fmt.Errorf("expected path followed by uid, gid, mode and size")
+		}
+		fields[i] = line[index+1:]
+		line = line[:index]
+	}
+
+	uid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid (%s)", fields[0])
+	}
+	gid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid (%s)", fields[1])
+	}
+	mode, err := strconv.ParseUint(fields[2], 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mode (%s)", fields[2])
+	}
+	size, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size (%s)", fields[3])
+	}
+
+	entry := &PackageFileEntry{
+		Path:    line,
+		Type:    FileTypeRegular,
+		Mode:    fs.FileMode(mode & 07777),
+		UserID:  uid,
+		GroupID: gid,
+		Size:    size,
+	}
+
+	// Determine file type
+	switch mode & unixTypeMask {
+	case unixTypeDir:
+		entry.Type = FileTypeDirectory
+	case unixTypeSymlink:
+		entry.Type = FileTypeSymlink
+	case unixTypeRegular, 0:
+	default:
+		entry.Type = FileTypeOther
+	}
+	if filePath, linkTarget, ok := strings.Cut(entry.Path, " -> "); ok {
+		entry.Type = FileTypeSymlink
+		entry.Path = filePath
+		entry.LinkTarget = linkTarget
+	}
+	if strings.HasSuffix(entry.Path, "/") {
+		entry.Type = FileTypeDirectory
+		entry.Path = strings.TrimRight(entry.Path, "/")
+	}
+
+	if entry.Path == "" {
+		return nil, fmt.Errorf("path cannot be empty")
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,111 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const CurrentFilesIndexVersion = 1
+
+type BPMFilesIndex struct {
+	IndexVersion int                 `yaml:"index_version"`
+	Files        map[string][]string `yaml:"files"` // File path to names of packages providing it
+}
+
+func ReadFilesIndex(path string) (*BPMFilesIndex, error) {
+	// Read index file
+	output, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &BPMFilesIndex{}
+
+	// Unmarshal yaml
+	err = yaml.Unmarshal(output, index)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure index version is supported
+	if index.IndexVersion > CurrentFilesIndexVersion {
+		return nil, fmt.Errorf("files index version %d is not supported", index.IndexVersion)
+	}
+
+	return index, nil
+}
+
+func cleanIndexPath(filePath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filePath), "/")
+}
+
+func (index *BPMFilesIndex) GetOwners(filePath string) []string {
+	return index.Files[cleanIndexPath(filePath)]
+}
+
+func (index *BPMFilesIndex) GetPackageFiles(pkgName string) []string {
+	files := make([]string, 0)
+	for filePath, owners := range index.Files {
+		if slices.Contains(owners, pkgName) {
+			files = append(files, filePath)
+		}
+	}
+	slices.Sort(files)
+
+	return files
+}
+
+func writeFilesIndex(path string, database *BPMDatabase, cache *databaseCache, options DatabaseOptions) error {
+	index := BPMFilesIndex{
+		IndexVersion: CurrentFilesIndexVersion,
+		Files:        make(map[string][]string),
+	}
+
+	// Add files of the latest version of every binary package
+	hasBinaryPackages := false
+	for name, entry := range database.Entries {
+		if entry.PackageInfo.Type != "binary" {
+			continue
+		}
+		hasBinaryPackages = true
+
+		for _, file := range cache.Entries[entry.Filepath].Files {
+			file = cleanIndexPath(file)
+			if !slices.Contains(index.Files[file], name) {
+				index.Files[file] = append(index.Files[file], name)
+			}
+		}
+	}
+	for _, owners := range index.Files {
+		slices.Sort(owners)
+	}
+
+	// Only binary package directories get a files index
+	if !hasBinaryPackages {
+		return removeFilesIndex(path)
+	}
+
+	data, err := yaml.Marshal(&index)
+	if err != nil {
+		return err
+	}
+
+	return writeDatabaseFile(filepath.Join(path, "files.bpmdb"), data, options)
+}
+
+func removeFilesIndex(path string) error {
+	for _, file := range []string{"files.bpmdb", "files.bpmdb.sig"} {
+		err := os.Remove(filepath.Join(path, file))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
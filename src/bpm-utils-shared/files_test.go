@@ -0,0 +1,112 @@
+package bpm_utils_shared
+
+import (
+	"testing"
+)
+
+func TestParsePackageFileEntry(t *testing.T) {
+	tests := []struct {
+		line string
+		want PackageFileEntry
+	}{
+		{
+			line: "usr/bin/foo 0 0 755 1024",
+			want: PackageFileEntry{Path: "usr/bin/foo", Type: FileTypeRegular, Mode: 0755, Size: 1024},
+		},
+		{
+			line: "usr/bin/foo 0 0 100755 1024",
+			want: PackageFileEntry{Path: "usr/bin/foo", Type: FileTypeRegular, Mode: 0755, Size: 1024},
+		},
+		{
+			line: "usr/share/doc/foo/read me.txt 1000 100 644 12",
+			want: PackageFileEntry{Path: "usr/share/doc/foo/read me.txt", Type: FileTypeRegular, Mode: 0644, UserID: 1000, GroupID: 100, Size: 12},
+		},
+		{
+			line: "usr/share/foo/ 0 0 755 0",
+			want: PackageFileEntry{Path: "usr/share/foo", Type: FileTypeDirectory, Mode: 0755},
+		},
+		{
+			line: "usr/share/foo 0 0 40755 0",
+			want: PackageFileEntry{Path: "usr/share/foo", Type: FileTypeDirectory, Mode: 0755},
+		},
+		{
+			line: "usr/share/my dir/ 0 0 755 0",
+			want: PackageFileEntry{Path: "usr/share/my dir", Type: FileTypeDirectory, Mode: 0755},
+		},
+		{
+			line: "usr/lib/libfoo.so -> libfoo.so.1 0 0 777 0",
+			want: PackageFileEntry{Path: "usr/lib/libfoo.so", Type: FileTypeSymlink, Mode: 0777, LinkTarget: "libfoo.so.1"},
+		},
+		{
+			line: "usr/lib/libfoo.so 0 0 120777 0",
+			want: PackageFileEntry{Path: "usr/lib/libfoo.so", Type: FileTypeSymlink, Mode: 0777},
+		},
+		{
+			line: "usr/share/my link -> ../other dir/file 0 0 120777 0",
+			want: PackageFileEntry{Path: "usr/share/my link", Type: FileTypeSymlink, Mode: 0777, LinkTarget: "../other dir/file"},
+		},
+		{
+			line: "dev/foo 0 0 20644 0",
+			want: PackageFileEntry{Path: "dev/foo", Type: FileTypeOther, Mode: 0644},
+		},
+		{
+			line: "run/foo.fifo 0 0 10600 0",
+			want: PackageFileEntry{Path: "run/foo.fifo", Type: FileTypeOther, Mode: 0600},
+		},
+		{
+			line: "usr/bin/foo 0 0 755 1024 \r",
+			want: PackageFileEntry{Path: "usr/bin/foo", Type: FileTypeRegular, Mode: 0755, Size: 1024},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			got, err := ParsePackageFileEntry(test.line)
+			if err != nil {
+				t.Fatalf("ParsePackageFileEntry() error = %s", err)
+			}
+			if *got != test.want {
+				t.Errorf("ParsePackageFileEntry() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestParsePackageFileEntryErrors(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"usr/bin/foo",
+		"usr/bin/foo 0 0 755",
+		"0 0 755 1024",
+		"usr/bin/foo x 0 755 1024",
+		"usr/bin/foo 0 x 755 1024",
+		"usr/bin/foo 0 0 789 1024",
+		"usr/bin/foo 0 0 755 x",
+		"/ 0 0 755 0",
+	} {
+		t.Run(line, func(t *testing.T) {
+			if got, err := ParsePackageFileEntry(line); err == nil {
+				t.Errorf("ParsePackageFileEntry() = %+v, want error", *got)
+			}
+		})
+	}
+}
+
+func TestParseFilesTxt(t *testing.T) {
+	files, err := ParseFilesTxt([]byte("usr/ 0 0 755 0\nusr/bin/foo 0 0 755 1024\n\nusr/bin/bar -> foo 0 0 777 0\n"))
+	if err != nil {
+		t.Fatalf("ParseFilesTxt() error = %s", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("ParseFilesTxt() returned %d entries, want 3", len(files))
+	}
+	for i, want := range []PackageFileType{FileTypeDirectory, FileTypeRegular, FileTypeSymlink} {
+		if files[i].Type != want {
+			t.Errorf("entry %d type = %s, want %s", i, files[i].Type, want)
+		}
+	}
+
+	if _, err := ParseFilesTxt([]byte("usr/ 0 0 755 0\nusr/bin/foo 0 0\n")); err == nil {
+		t.Errorf("ParseFilesTxt() of invalid line succeeded, want error")
+	}
+}
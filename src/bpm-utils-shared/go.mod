@@ -6,4 +6,11 @@ require gopkg.in/yaml.v3 v3.0.1
 
 require github.com/drone/envsubst v1.0.3
 
-require github.com/knqyf263/go-rpm-version v0.0.0-20240918084003-2afd7dc6a38f // indirect
+require github.com/knqyf263/go-rpm-version v0.0.0-20240918084003-2afd7dc6a38f
+
+require github.com/klauspost/compress v1.17.11
+
+require (
+	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.28.0 // indirect
+)
@@ -0,0 +1,438 @@
+package bpm_utils_shared
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PackageInfoEditor changes fields of an info.yml document in place. Only the bytes of edited values are replaced,
+// so comments, blank lines and key order are preserved. Missing keys are inserted on their own line after a
+// related key
+type PackageInfoEditor struct {
+	data       []byte
+	root       *yaml.Node
+	lineStarts []int
+	edits      []infoEdit
+	inserted   map[*yaml.Node]map[string]insertedKey // Edits inserting keys into mappings
+}
+
+type insertedKey struct {
+	edit   int // Index of edit
+	indent string
+}
+
+type infoEdit struct {
+	start, end int
+	text       string
+}
+
+func NewPackageInfoEditor(data []byte) (*PackageInfoEditor, error) {
+	var document yaml.Node
+	err := yaml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("package info is not a mapping")
+	}
+
+	editor := &PackageInfoEditor{
+		data:       data,
+		root:       document.Content[0],
+		lineStarts: []int{0},
+		inserted:   make(map[*yaml.Node]map[string]insertedKey),
+	}
+	for i, b := range data {
+		if b == '\n' {
+			editor.lineStarts = append(editor.lineStarts, i+1)
+		}
+	}
+
+	return editor, nil
+}
+
+// EditPackageInfoFile applies changes made by edit to an info.yml file
+func EditPackageInfoFile(path string, edit func(editor *PackageInfoEditor) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	editor, err := NewPackageInfoEditor(data)
+	if err != nil {
+		return err
+	}
+	err = edit(editor)
+	if err != nil {
+		return err
+	}
+
+	newData := editor.Bytes()
+	if bytes.Equal(data, newData) {
+		return nil
+	}
+	return WriteFileAtomic(path, newData, stat.Mode().Perm())
+}
+
+// Bytes returns the edited document
+func (editor *PackageInfoEditor) Bytes() []byte {
+	// Apply edits from the end of the document so earlier offsets stay valid. Insertions at the same
+	// offset are applied in reverse so they end up in the order they were made
+	edits := slices.Clone(editor.edits)
+	slices.Reverse(edits)
+	slices.SortStableFunc(edits, func(a, b infoEdit) int {
+		return b.start - a.start
+	})
+
+	data := slices.Clone(editor.data)
+	for _, edit := range edits {
+		data = slices.Concat(data[:edit.start], []byte(edit.text), data[edit.end:])
+	}
+
+	return data
+}
+
+func (editor *PackageInfoEditor) SetVersion(version string) error {
+	return editor.setScalar(editor.root, "version", version, "!!str", "name")
+}
+
+// SetRevision sets the revision of the package. A missing revision is only inserted if it differs from the
+// default revision of 1
+func (editor *PackageInfoEditor) SetRevision(revision int) error {
+	_, inserted := editor.inserted[editor.root]["revision"]
+	if revision == 1 && !inserted && mappingValue(editor.root, "revision") == nil {
+		return nil
+	}
+
+	return editor.setScalar(editor.root, "revision", strconv.Itoa(revision), "!!int", "version")
+}
+
+func (editor *PackageInfoEditor) SetDownloadChecksum(index int, checksum string) error {
+	download := itemNode(editor.root, "downloads", index)
+	if download == nil {
+		return fmt.Errorf("download entry %d does not exist", index+1)
+	}
+
+	return editor.setScalar(download, "checksum", checksum, "!!str", "url")
+}
+
+// SetArchDownloadChecksum sets the checksum of a download in the architecture overrides for arch
+func (editor *PackageInfoEditor) SetArchDownloadChecksum(arch string, index int, checksum string) error {
+	download := itemNode(mappingValue(mappingValue(editor.root, "arch_overrides"), arch), "downloads", index)
+	if download == nil {
+		return fmt.Errorf("%s download entry %d does not exist", arch, index+1)
+	}
+
+	return editor.setScalar(download, "checksum", checksum, "!!str", "url")
+}
+
+func (editor *PackageInfoEditor) AddMaintainer(maintainer string) error {
+	if editor.root.Style&yaml.FlowStyle != 0 {
+		return fmt.Errorf("cannot edit 'maintainers' field in flow mapping")
+	}
+
+	encoded, err := encodeScalar(maintainer, "!!str", 0)
+	if err != nil {
+		return err
+	}
+
+	maintainers := mappingValue(editor.root, "maintainers")
+	switch {
+	case maintainers == nil:
+		// Add new maintainers list
+		if inserted, ok := editor.inserted[editor.root]["maintainers"]; ok {
+			editor.edits[inserted.edit].text += "\n" + inserted.indent + "  - " + encoded
+			return nil
+		}
+		return editor.insertKey(editor.root, "maintainers", func(indent string) string {
+			return "\n" + indent + "  - " + encoded
+		}, "license", "url", "description", "name")
+	case maintainers.Kind == yaml.ScalarNode && maintainers.Tag == "!!null":
+		// Replace empty value with flow sequence
+		if maintainers.Value != "" {
+			start, end, err := editor.scalarRange(maintainers)
+			if err != nil {
+				return err
+			}
+			return editor.addEdit(start, end, "["+encoded+"]")
+		}
+		start, end, err := editor.valueRange(editor.root, "maintainers")
+		if err != nil {
+			return err
+		}
+		return editor.addEdit(start, end, " ["+encoded+"]")
+	case maintainers.Kind != yaml.SequenceNode:
+		return fmt.Errorf("'maintainers' field is not a list")
+	case maintainers.Style&yaml.FlowStyle != 0:
+		// Insert item before the end of the flow sequence
+		if len(maintainers.Content) == 0 {
+			start := editor.offset(maintainers.Line, maintainers.Column) + 1
+			return editor.addEdit(start, start, encoded)
+		}
+		_, end, err := editor.scalarRange(maintainers.Content[len(maintainers.Content)-1])
+		if err != nil {
+			return err
+		}
+		return editor.addEdit(end, end, ", "+encoded)
+	default:
+		// Append item to block sequence
+		if len(maintainers.Content) == 0 {
+			return fmt.Errorf("'maintainers' field is empty")
+		}
+		lastItem := maintainers.Content[len(maintainers.Content)-1]
+		_, end, err := editor.scalarRange(lastItem)
+		if err != nil {
+			return err
+		}
+		itemStart := editor.offset(lastItem.Line, lastItem.Column)
+		lineStart := editor.lineStarts[lastItem.Line-1]
+		dash := bytes.LastIndexByte(editor.data[lineStart:itemStart], '-')
+		if dash == -1 {
+			return fmt.Errorf("could not find list item in 'maintainers' field")
+		}
+		lineEnd := editor.lineEnd(end)
+		return editor.addEdit(lineEnd, lineEnd, "\n"+strings.Repeat(" ", dash)+"- "+encoded)
+	}
+}
+
+// setScalar replaces the value of key in mapping or inserts the key after the first existing anchor key
+func (editor *PackageInfoEditor) setScalar(mapping *yaml.Node, key, value, tag string, anchors ...string) error {
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("cannot edit '%s' field in non-mapping node", key)
+	}
+	flow := mapping.Style&yaml.FlowStyle != 0
+
+	valueNode := mappingValue(mapping, key)
+	// Keys can only be replaced in place in flow mappings such as '- {url: ..., checksum: ...}'
+	if flow && (valueNode == nil || valueNode.Kind != yaml.ScalarNode || valueNode.Tag == "!!null") {
+		return fmt.Errorf("cannot insert '%s' field into flow mapping", key)
+	}
+	style := yaml.Style(0)
+	if valueNode != nil {
+		style = valueNode.Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle)
+	}
+	encoded, err := encodeScalar(value, tag, style)
+	if err != nil {
+		return err
+	}
+
+	// Keep unquoted strings such as 'version: 1.0' unquoted if they are still read back as the same value
+	if tag == "!!str" && valueNode != nil && valueNode.Kind == yaml.ScalarNode && valueNode.Style == 0 && valueNode.Tag != "!!null" {
+		if plain, err := encodeScalar(value, "", 0); err == nil && isPlainString(plain, value) {
+			encoded = plain
+		}
+	}
+	// Quote values containing flow indicators inside flow mappings
+	if flow && !strings.HasPrefix(encoded, "\"") && !strings.HasPrefix(encoded, "'") && strings.ContainsAny(encoded, ",[]{}") {
+		if encoded, err = encodeScalar(value, tag, yaml.DoubleQuotedStyle); err != nil {
+			return err
+		}
+	}
+
+	// Update previously inserted key
+	if inserted, ok := editor.inserted[mapping][key]; ok {
+		editor.edits[inserted.edit].text = "\n" + inserted.indent + key + ": " + encoded
+		return nil
+	}
+
+	if valueNode == nil {
+		return editor.insertKey(mapping, key, func(string) string { return " " + encoded }, anchors...)
+	}
+
+	// Replace empty value
+	if valueNode.Kind == yaml.ScalarNode && valueNode.Tag == "!!null" && valueNode.Value == "" {
+		start, end, err := editor.valueRange(mapping, key)
+		if err != nil {
+			return err
+		}
+		return editor.addEdit(start, end, " "+encoded)
+	}
+
+	start, end, err := editor.scalarRange(valueNode)
+	if err != nil {
+		return fmt.Errorf("cannot edit '%s' field: %s", key, err)
+	}
+	return editor.addEdit(start, end, encoded)
+}
+
+// insertKey adds a key on a new line after the value of the first existing anchor key, or after the first key with a
+// single line value. formatValue receives the indentation of the mapping and returns the text following the colon
+func (editor *PackageInfoEditor) insertKey(mapping *yaml.Node, key string, formatValue func(indent string) string, anchors ...string) error {
+	candidates := make([]int, 0)
+	for _, anchor := range anchors {
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == anchor {
+				candidates = append(candidates, i)
+			}
+		}
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		candidates = append(candidates, i)
+	}
+
+	for _, i := range candidates {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		if valueNode.Kind != yaml.ScalarNode {
+			continue
+		}
+		_, end, err := editor.scalarRange(valueNode)
+		if err != nil {
+			continue
+		}
+
+		indent := strings.Repeat(" ", keyNode.Column-1)
+		lineEnd := editor.lineEnd(end)
+		err = editor.addEdit(lineEnd, lineEnd, "\n"+indent+key+":"+formatValue(indent))
+		if err != nil {
+			return err
+		}
+
+		if editor.inserted[mapping] == nil {
+			editor.inserted[mapping] = make(map[string]insertedKey)
+		}
+		editor.inserted[mapping][key] = insertedKey{edit: len(editor.edits) - 1, indent: indent}
+		return nil
+	}
+
+	return fmt.Errorf("could not find a place to insert '%s' field", key)
+}
+
+func (editor *PackageInfoEditor) addEdit(start, end int, text string) error {
+	// Replace earlier edit of the same range
+	for i, edit := range editor.edits {
+		if edit.start == start && edit.end == end && start != end {
+			editor.edits[i].text = text
+			return nil
+		}
+		if edit.start < end && start < edit.end {
+			return fmt.Errorf("overlapping edits")
+		}
+	}
+
+	editor.edits = append(editor.edits, infoEdit{start: start, end: end, text: text})
+	return nil
+}
+
+// offset converts a 1-based line and character column to a byte offset
+func (editor *PackageInfoEditor) offset(line, column int) int {
+	offset := editor.lineStarts[line-1]
+	for range column - 1 {
+		_, size := utf8.DecodeRune(editor.data[offset:])
+		offset += size
+	}
+
+	return offset
+}
+
+// lineEnd returns the offset of the end of the line containing offset, excluding line endings
+func (editor *PackageInfoEditor) lineEnd(offset int) int {
+	end := bytes.IndexByte(editor.data[offset:], '\n')
+	if end == -1 {
+		return len(editor.data)
+	}
+	end += offset
+	if end > offset && editor.data[end-1] == '\r' {
+		end--
+	}
+
+	return end
+}
+
+// scalarRange returns the byte range of a single line scalar in the source document
+func (editor *PackageInfoEditor) scalarRange(node *yaml.Node) (int, int, error) {
+	if node.Kind != yaml.ScalarNode {
+		return 0, 0, fmt.Errorf("value is not a scalar")
+	}
+	start := editor.offset(node.Line, node.Column)
+	lineEnd := editor.lineEnd(start)
+	line := editor.data[start:lineEnd]
+
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				return start, start + i + 1, nil
+			}
+		}
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return start, start + i + 1, nil
+			}
+		}
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return 0, 0, fmt.Errorf("block scalars are not supported")
+	default:
+		// Plain scalars on a single line appear in the source exactly as their value
+		if bytes.HasPrefix(line, []byte(node.Value)) {
+			return start, start + len(node.Value), nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("values spanning multiple lines are not supported")
+}
+
+// valueRange returns the range after the colon of a key with an empty value
+func (editor *PackageInfoEditor) valueRange(mapping *yaml.Node, key string) (int, int, error) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		_, keyEnd, err := editor.scalarRange(mapping.Content[i])
+		if err != nil {
+			return 0, 0, err
+		}
+		colon := bytes.IndexByte(editor.data[keyEnd:editor.lineEnd(keyEnd)], ':')
+		if colon == -1 {
+			return 0, 0, fmt.Errorf("could not find value of '%s' field", key)
+		}
+		end := keyEnd + colon + 1
+		for end < len(editor.data) && (editor.data[end] == ' ' || editor.data[end] == '\t') {
+			end++
+		}
+		// Keep whitespace separating a trailing comment
+		if end < len(editor.data) && editor.data[end] == '#' {
+			end--
+		}
+		return keyEnd + colon + 1, end, nil
+	}
+
+	return 0, 0, fmt.Errorf("'%s' field does not exist", key)
+}
+
+// isPlainString reports whether encoded is an unquoted scalar which is read back into a string field as value
+func isPlainString(encoded, value string) bool {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(encoded), &node); err != nil || len(node.Content) == 0 {
+		return false
+	}
+	scalar := node.Content[0]
+
+	return scalar.Kind == yaml.ScalarNode && scalar.Style == 0 && scalar.Tag != "!!null" && scalar.Value == value
+}
+
+func encodeScalar(value, tag string, style yaml.Style) (string, error) {
+	data, err := yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Style: style})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
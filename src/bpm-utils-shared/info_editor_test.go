@@ -0,0 +1,282 @@
+package bpm_utils_shared
+
+import (
+	"testing"
+)
+
+func TestPackageInfoEditor(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		edit  func(editor *PackageInfoEditor) error
+		want  string
+	}{
+		{
+			name:  "keeps comments",
+			input: "# Package info\nname: foo # name\nversion: 1.0 # upstream version\n\n# Revision\nrevision: 3\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("1.1")
+			},
+			want: "# Package info\nname: foo # name\nversion: 1.1 # upstream version\n\n# Revision\nrevision: 3\n",
+		},
+		{
+			name:  "keeps double quotes",
+			input: "name: foo\nversion: \"1.0\"\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("2.0")
+			},
+			want: "name: foo\nversion: \"2.0\"\n",
+		},
+		{
+			name:  "keeps single quotes",
+			input: "name: foo\nversion: '1.0'\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("2.0")
+			},
+			want: "name: foo\nversion: '2.0'\n",
+		},
+		{
+			name:  "keeps plain style",
+			input: "name: foo\nversion: abc\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("2.0")
+			},
+			want: "name: foo\nversion: 2.0\n",
+		},
+		{
+			name:  "quotes plain values which would be read back as null",
+			input: "name: foo\nversion: 1.0\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("null")
+			},
+			want: "name: foo\nversion: \"null\"\n",
+		},
+		{
+			name:  "keeps crlf line endings",
+			input: "name: foo\r\nversion: 1.0\r\nrevision: 2\r\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("1.1")
+			},
+			want: "name: foo\r\nversion: 1.1\r\nrevision: 2\r\n",
+		},
+		{
+			name:  "inserts missing key after anchor",
+			input: "name: foo\nversion: 1.0\ndescription: Foo\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetRevision(2)
+			},
+			want: "name: foo\nversion: 1.0\nrevision: 2\ndescription: Foo\n",
+		},
+		{
+			name:  "updates inserted key",
+			input: "name: foo\nversion: 1.0\n",
+			edit: func(editor *PackageInfoEditor) error {
+				if err := editor.SetRevision(2); err != nil {
+					return err
+				}
+				return editor.SetRevision(3)
+			},
+			want: "name: foo\nversion: 1.0\nrevision: 3\n",
+		},
+		{
+			name:  "does not insert default revision",
+			input: "name: foo\nversion: 1.0\n",
+			edit: func(editor *PackageInfoEditor) error {
+				if err := editor.SetVersion("1.1"); err != nil {
+					return err
+				}
+				return editor.SetRevision(1)
+			},
+			want: "name: foo\nversion: 1.1\n",
+		},
+		{
+			name:  "replaces existing revision",
+			input: "name: foo\nversion: 1.0\nrevision: 4\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetRevision(1)
+			},
+			want: "name: foo\nversion: 1.0\nrevision: 1\n",
+		},
+		{
+			name:  "replaces empty value",
+			input: "name: foo\nversion:\nrevision: 1\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("1.0")
+			},
+			want: "name: foo\nversion: \"1.0\"\nrevision: 1\n",
+		},
+		{
+			name:  "sets download checksum",
+			input: "name: foo\ndownloads:\n  - url: https://example.com/foo.tar.gz # source\n    checksum: abc\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetDownloadChecksum(0, "def")
+			},
+			want: "name: foo\ndownloads:\n  - url: https://example.com/foo.tar.gz # source\n    checksum: def\n",
+		},
+		{
+			name:  "inserts download checksum",
+			input: "name: foo\ndownloads:\n  - url: https://example.com/foo.tar.gz\n    no_extract: true\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetDownloadChecksum(0, "def")
+			},
+			want: "name: foo\ndownloads:\n  - url: https://example.com/foo.tar.gz\n    checksum: def\n    no_extract: true\n",
+		},
+		{
+			name:  "sets architecture override download checksum",
+			input: "name: foo\narch_overrides:\n  aarch64:\n    downloads:\n      - url: https://example.com/foo-aarch64.tar.gz\n        checksum: abc\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetArchDownloadChecksum("aarch64", 0, "def")
+			},
+			want: "name: foo\narch_overrides:\n  aarch64:\n    downloads:\n      - url: https://example.com/foo-aarch64.tar.gz\n        checksum: def\n",
+		},
+		{
+			name:  "sets checksum in flow mapping",
+			input: "name: foo\ndownloads:\n  - {url: https://example.com/foo.tar.gz, checksum: abc} # source\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetDownloadChecksum(0, "def")
+			},
+			want: "name: foo\ndownloads:\n  - {url: https://example.com/foo.tar.gz, checksum: def} # source\n",
+		},
+		{
+			name:  "sets quoted checksum in flow mapping",
+			input: "name: foo\ndownloads:\n  - {checksum: 'abc', url: https://example.com/foo.tar.gz}\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetDownloadChecksum(0, "def")
+			},
+			want: "name: foo\ndownloads:\n  - {checksum: 'def', url: https://example.com/foo.tar.gz}\n",
+		},
+		{
+			name:  "quotes flow indicators in flow mapping",
+			input: "{name: foo, version: 1.0}\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("1,1")
+			},
+			want: "{name: foo, version: \"1,1\"}\n",
+		},
+		{
+			name:  "appends to block sequence",
+			input: "name: foo\nmaintainers:\n  - Alice # lead\n  - Bob\nlicense: MIT\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.AddMaintainer("Carol")
+			},
+			want: "name: foo\nmaintainers:\n  - Alice # lead\n  - Bob\n  - Carol\nlicense: MIT\n",
+		},
+		{
+			name:  "appends to flow sequence",
+			input: "name: foo\nmaintainers: [Alice, Bob] # maintainers\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.AddMaintainer("Carol")
+			},
+			want: "name: foo\nmaintainers: [Alice, Bob, Carol] # maintainers\n",
+		},
+		{
+			name:  "appends to empty flow sequence",
+			input: "name: foo\nmaintainers: []\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.AddMaintainer("Carol")
+			},
+			want: "name: foo\nmaintainers: [Carol]\n",
+		},
+		{
+			name:  "inserts maintainers",
+			input: "name: foo\nlicense: MIT\ntype: source\n",
+			edit: func(editor *PackageInfoEditor) error {
+				if err := editor.AddMaintainer("Alice"); err != nil {
+					return err
+				}
+				return editor.AddMaintainer("Bob")
+			},
+			want: "name: foo\nlicense: MIT\nmaintainers:\n  - Alice\n  - Bob\ntype: source\n",
+		},
+		{
+			name:  "quotes maintainer",
+			input: "name: foo\nmaintainers:\n  - Alice\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.AddMaintainer("Carol: lead")
+			},
+			want: "name: foo\nmaintainers:\n  - Alice\n  - 'Carol: lead'\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			editor, err := NewPackageInfoEditor([]byte(test.input))
+			if err != nil {
+				t.Fatalf("NewPackageInfoEditor() error = %s", err)
+			}
+			if err := test.edit(editor); err != nil {
+				t.Fatalf("edit error = %s", err)
+			}
+			if got := string(editor.Bytes()); got != test.want {
+				t.Errorf("Bytes() =\n%q\nwant\n%q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPackageInfoEditorErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		edit  func(editor *PackageInfoEditor) error
+	}{
+		{
+			name:  "insert field into flow mapping",
+			input: "{name: foo, version: 1.0}\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetRevision(2)
+			},
+		},
+		{
+			name:  "insert checksum into flow mapping",
+			input: "name: foo\ndownloads:\n  - {url: https://example.com/foo.tar.gz}\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetDownloadChecksum(0, "abc")
+			},
+		},
+		{
+			name:  "add maintainer to flow mapping",
+			input: "{name: foo, version: 1.0}\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.AddMaintainer("Alice")
+			},
+		},
+		{
+			name:  "set block scalar",
+			input: "name: foo\nversion: |\n  1.0\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetVersion("1.1")
+			},
+		},
+		{
+			name:  "add maintainer to non-list",
+			input: "name: foo\nmaintainers: Alice\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.AddMaintainer("Bob")
+			},
+		},
+		{
+			name:  "set checksum of missing download",
+			input: "name: foo\ndownloads: []\n",
+			edit: func(editor *PackageInfoEditor) error {
+				return editor.SetDownloadChecksum(0, "abc")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			editor, err := NewPackageInfoEditor([]byte(test.input))
+			if err != nil {
+				t.Fatalf("NewPackageInfoEditor() error = %s", err)
+			}
+			if err := test.edit(editor); err == nil {
+				t.Errorf("edit succeeded, want error. Bytes() = %q", editor.Bytes())
+			}
+		})
+	}
+
+	if _, err := NewPackageInfoEditor([]byte("- foo\n")); err == nil {
+		t.Errorf("NewPackageInfoEditor() of sequence succeeded, want error")
+	}
+}
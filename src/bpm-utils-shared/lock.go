@@ -0,0 +1,82 @@
+package bpm_utils_shared
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// RepositoryLockEnv is the environment variable CLIs use to pass the PID of the process holding a repository lock
+// down to child processes
+const RepositoryLockEnv = "BPM_UTILS_REPO_LOCK_PID"
+
+type RepositoryLock struct {
+	file      *os.File // Locked file, nil if the lock is inherited or released
+	inherited bool
+}
+
+// LockRepository takes an exclusive lock on the repository. The lock is released by Unlock or when the process
+// exits. If the repository is locked by the process with PID inheritedPID, usually a parent process, a lock which
+// does not need to be released is returned. inheritedPID may be 0
+func LockRepository(repository string, inheritedPID int) (*RepositoryLock, error) {
+	lockPath := path.Join(repository, ".bpm-repo.lock")
+
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		file.Close()
+
+		// The PID is only informational and may be missing if the lock was just acquired
+		data, _ := os.ReadFile(lockPath)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("repository is locked by another process")
+		}
+		if inheritedPID != 0 && pid == inheritedPID {
+			return &RepositoryLock{inherited: true}, nil
+		}
+
+		return nil, fmt.Errorf("repository is locked by PID %d", pid)
+	} else if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Record PID of lock holder
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &RepositoryLock{file: file}, nil
+}
+
+// Inherited reports whether the lock is held by another process the lock was inherited from
+func (lock *RepositoryLock) Inherited() bool {
+	return lock.inherited
+}
+
+// Unlock releases the lock. The lock file is kept, as removing it would allow another process to lock a new file
+// while a third process still holds the removed one
+func (lock *RepositoryLock) Unlock() error {
+	if lock.file == nil {
+		return nil
+	}
+	file := lock.file
+	lock.file = nil
+
+	// Closing the file releases the lock
+	return file.Close()
+}
@@ -0,0 +1,119 @@
+package bpm_utils_shared
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLockRepository(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockFile *string // Contents of an unlocked lock file left behind before locking, nil for none
+	}{
+		{name: "no lock file"},
+		{name: "stale lock file", lockFile: stringPtr("999999999\n")},
+		{name: "lock file of running process", lockFile: stringPtr(strconv.Itoa(os.Getppid()) + "\n")},
+		{name: "empty lock file", lockFile: stringPtr("")},
+		{name: "invalid lock file", lockFile: stringPtr("foo")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := t.TempDir()
+			lockPath := filepath.Join(repo, ".bpm-repo.lock")
+			if test.lockFile != nil {
+				if err := os.WriteFile(lockPath, []byte(*test.lockFile), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			lock, err := LockRepository(repo, 0)
+			if err != nil {
+				t.Fatalf("LockRepository() error = %s", err)
+			}
+			if lock.Inherited() {
+				t.Errorf("Inherited() = true, want false")
+			}
+			data, err := os.ReadFile(lockPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := strings.TrimSpace(string(data)), strconv.Itoa(os.Getpid()); got != want {
+				t.Errorf("lock file contains PID %s, want %s", got, want)
+			}
+
+			// Ensure lock cannot be taken again
+			if _, err := LockRepository(repo, 0); err == nil {
+				t.Errorf("second LockRepository() succeeded, want error")
+			} else if !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+				t.Errorf("second LockRepository() error = %s, want error containing PID", err)
+			}
+
+			// Ensure lock can be inherited by the holder's PID only
+			if _, err := LockRepository(repo, os.Getpid()+1); err == nil {
+				t.Errorf("LockRepository() with wrong inherited PID succeeded, want error")
+			}
+			inherited, err := LockRepository(repo, os.Getpid())
+			if err != nil {
+				t.Fatalf("LockRepository() with inherited PID error = %s", err)
+			}
+			if !inherited.Inherited() {
+				t.Errorf("Inherited() = false, want true")
+			}
+			if err := inherited.Unlock(); err != nil {
+				t.Errorf("Unlock() of inherited lock error = %s", err)
+			}
+
+			// Ensure lock can be taken again after unlocking
+			if err := lock.Unlock(); err != nil {
+				t.Fatalf("Unlock() error = %s", err)
+			}
+			if err := lock.Unlock(); err != nil {
+				t.Errorf("second Unlock() error = %s", err)
+			}
+			lock, err = LockRepository(repo, 0)
+			if err != nil {
+				t.Fatalf("LockRepository() after Unlock() error = %s", err)
+			}
+			lock.Unlock()
+		})
+	}
+}
+
+func TestLockRepositoryConcurrent(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, ".bpm-repo.lock"), []byte("999999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure exactly one of many concurrent attempts to take over a stale lock succeeds
+	locks := make([]*RepositoryLock, 16)
+	var wg sync.WaitGroup
+	for i := range locks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locks[i], _ = LockRepository(repo, 0)
+		}()
+	}
+	wg.Wait()
+
+	acquired := 0
+	for _, lock := range locks {
+		if lock != nil {
+			acquired++
+			defer lock.Unlock()
+		}
+	}
+	if acquired != 1 {
+		t.Errorf("%d locks acquired, want 1", acquired)
+	}
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
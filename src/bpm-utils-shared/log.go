@@ -0,0 +1,49 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Logger receives progress and warning messages from bpm-utils-shared
+type Logger interface {
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+}
+
+// DefaultLogger prints progress messages to stdout and warnings through the standard logger
+type DefaultLogger struct{}
+
+func (DefaultLogger) Infof(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (DefaultLogger) Warnf(format string, args ...any) {
+	log.Printf("Warning: "+format, args...)
+}
+
+// NopLogger discards all messages
+type NopLogger struct{}
+
+func (NopLogger) Infof(format string, args ...any) {}
+
+func (NopLogger) Warnf(format string, args ...any) {}
+
+var logger Logger = DefaultLogger{}
+
+// SetLogger replaces the logger used by bpm-utils-shared. It should be called before any other function
+func SetLogger(newLogger Logger) {
+	if newLogger == nil {
+		newLogger = NopLogger{}
+	}
+	logger = newLogger
+}
+
+// Standard streams connected to external commands such as gpg and git
+var (
+	CommandStdin  io.Reader = os.Stdin
+	CommandStdout io.Writer = os.Stdout
+	CommandStderr io.Writer = os.Stderr
+)
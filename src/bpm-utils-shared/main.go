@@ -10,6 +10,10 @@ type BPMUtilsConfig struct {
 	PrivilegeEscalatorCmd string `yaml:"privilege_escalator_cmd"`
 	DefaultMaintainer     string `yaml:"default_maintainer,omitempty"`
 	AddDefaultMaintainer  bool   `yaml:"add_default_maintainer,omitempty"`
+	DatabaseWorkers       int    `yaml:"database_workers,omitempty"`
+	DownloadWorkers       int    `yaml:"download_workers,omitempty"`
+	SourceCacheDir        string `yaml:"source_cache_dir,omitempty"`
+	SourceCacheMaxSize    int64  `yaml:"source_cache_max_size,omitempty"` // In MiB
 }
 
 func ReadBPMUtilsConfig() (*BPMUtilsConfig, error) {
@@ -1,55 +1,65 @@
 package bpm_utils_shared
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
-	"os/exec"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
-	"github.com/drone/envsubst"
 	version "github.com/knqyf263/go-rpm-version"
 	"gopkg.in/yaml.v3"
 )
 
 type PackageInfo struct {
-	Name            string            `yaml:"name"`
-	Description     string            `yaml:"description,omitempty"`
-	Version         string            `yaml:"version,omitempty"`
-	Revision        int               `yaml:"revision,omitempty"`
-	Url             string            `yaml:"url,omitempty"`
-	License         string            `yaml:"license,omitempty"`
-	Maintainers     []string          `yaml:"maintainers,omitempty"`
-	Arch            string            `yaml:"architecture,omitempty"`
-	OutputArch      string            `yaml:"output_architecture,omitempty"`
-	Type            string            `yaml:"type,omitempty"`
-	Keep            []string          `yaml:"keep,omitempty"`
-	Depends         []string          `yaml:"depends,omitempty"`
-	RuntimeDepends  []string          `yaml:"runtime_depends,omitempty"`
-	OptionalDepends []string          `yaml:"optional_depends,omitempty"`
-	MakeDepends     []string          `yaml:"make_depends,omitempty"`
-	CheckDepends    []string          `yaml:"check_depends,omitempty"`
-	Conflicts       []string          `yaml:"conflicts,omitempty"`
-	Replaces        []string          `yaml:"replaces,omitempty"`
-	Provides        []string          `yaml:"provides,omitempty"`
-	Options         []string          `yaml:"options,omitempty"`
-	Downloads       []PackageDownload `yaml:"downloads,omitempty"`
-	SplitPackages   []*PackageInfo    `yaml:"split_packages,omitempty"`
+	Name            string                   `yaml:"name"`
+	Description     string                   `yaml:"description,omitempty"`
+	Version         string                   `yaml:"version,omitempty"`
+	Epoch           int                      `yaml:"epoch,omitempty"`
+	Revision        int                      `yaml:"revision,omitempty"`
+	Url             string                   `yaml:"url,omitempty"`
+	License         string                   `yaml:"license,omitempty"`
+	Maintainers     []string                 `yaml:"maintainers,omitempty"`
+	Arch            string                   `yaml:"architecture,omitempty"`
+	OutputArch      string                   `yaml:"output_architecture,omitempty"`
+	Type            string                   `yaml:"type,omitempty"`
+	Keep            []string                 `yaml:"keep,omitempty"`
+	Depends         []string                 `yaml:"depends,omitempty"`
+	RuntimeDepends  []string                 `yaml:"runtime_depends,omitempty"`
+	OptionalDepends []string                 `yaml:"optional_depends,omitempty"`
+	MakeDepends     []string                 `yaml:"make_depends,omitempty"`
+	CheckDepends    []string                 `yaml:"check_depends,omitempty"`
+	Conflicts       []string                 `yaml:"conflicts,omitempty"`
+	Replaces        []string                 `yaml:"replaces,omitempty"`
+	Provides        []string                 `yaml:"provides,omitempty"`
+	Options         []string                 `yaml:"options,omitempty"`
+	Variables       map[string]string        `yaml:"variables,omitempty"`
+	Downloads       []PackageDownload        `yaml:"downloads,omitempty"`
+	ArchOverrides   map[string]*ArchOverride `yaml:"arch_overrides,omitempty"`
+	SplitPackages   []*PackageInfo           `yaml:"split_packages,omitempty"`
+
+	node *yaml.Node // Mapping node the package info was decoded from, used for validation
 }
 
 type PackageDownload struct {
-	Url      string `yaml:"url"`
-	Type     string `yaml:"type,omitempty"`
-	Filepath string `yaml:"filepath,omitempty,omitempty"`
+	Url      string   `yaml:"url"`
+	Mirrors  []string `yaml:"mirrors,omitempty"` // Alternative urls serving the same download, tried in order
+	Type     string   `yaml:"type,omitempty"`
+	Filepath string   `yaml:"filepath,omitempty,omitempty"`
 
 	// Archive options
 	NoExtract              bool   `yaml:"no_extract,omitempty"`
 	ExtractTo              string `yaml:"extract_to,omitempty"`
 	ExtractStripComponents int    `yaml:"extract_strip_components,omitempty"`
 
-	// Git options
+	// Version control options
 	CloneTo   string `yaml:"clone_to,omitempty"`
 	GitBranch string `yaml:"git_branch,omitempty"`
+	HgBranch  string `yaml:"hg_branch,omitempty"` // Branch, bookmark or tag. Defaults to 'default'
 
 	Checksum string `yaml:"checksum,omitempty"`
 }
@@ -71,32 +81,112 @@ func ReadPackageInfo(data []byte) (*PackageInfo, error) {
 	}
 
 	// Unmarshal yaml
-	err := yaml.Unmarshal(data, pkgInfo)
+	var document yaml.Node
+	err := yaml.Unmarshal(data, &document)
 	if err != nil {
 		return nil, err
 	}
+	if len(document.Content) == 0 {
+		return pkgInfo, nil
+	}
+	err = document.Decode(pkgInfo)
+	if err != nil {
+		return nil, err
+	}
+	pkgInfo.node = document.Content[0]
 
 	return pkgInfo, nil
 }
 
 func (pkgInfo *PackageInfo) GetFullVersion() string {
-	return pkgInfo.Version + "-" + strconv.Itoa(pkgInfo.Revision)
+	fullVersion := pkgInfo.Version + "-" + strconv.Itoa(pkgInfo.Revision)
+	if pkgInfo.Epoch > 0 {
+		fullVersion = strconv.Itoa(pkgInfo.Epoch) + ":" + fullVersion
+	}
+	return fullVersion
 }
 
-func ReadPacakgeInfoFromTarball(path string) (*PackageInfo, error) {
-	// Extract package info using tar
-	cmd := exec.Command("tar", "-x", "-f", path, "info.yml", "-O")
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, err
+// Split package inheritance rules, listed by yaml field name. See ResolveSplitPackages
+var (
+	// splitPackageInheritedFields are always inherited from the source package and cannot be set
+	splitPackageInheritedFields = []string{"version", "epoch", "revision"}
+	// splitPackageDefaultFields are inherited from the source package if not set
+	splitPackageDefaultFields = []string{"description", "url", "license", "maintainers", "architecture", "output_architecture"}
+	// splitPackageSourceOnlyFields only apply to the source package and are cleared
+	splitPackageSourceOnlyFields = []string{"variables", "downloads", "split_packages"}
+)
+
+// ResolveSplitPackages returns copies of the split packages of a source package with inherited fields populated.
+// Split packages inherit fields from their source package as follows:
+//   - version, epoch and revision are always inherited
+//   - description, url, license, maintainers, architecture and output_architecture are inherited if not set
+//   - type is always 'binary'
+//
+// Dependencies, conflicts, provides, keep and options are never inherited. Downloads, variables and split
+// packages only apply to the source package and are cleared
+func (pkgInfo *PackageInfo) ResolveSplitPackages() []*PackageInfo {
+	splitPkgs := make([]*PackageInfo, 0, len(pkgInfo.SplitPackages))
+	for _, splitPkg := range pkgInfo.SplitPackages {
+		if splitPkg == nil {
+			continue
+		}
+		splitPkgs = append(splitPkgs, pkgInfo.resolveSplitPackage(splitPkg))
 	}
 
-	pkgInfo, err := ReadPackageInfo(output)
+	return splitPkgs
+}
+
+func (pkgInfo *PackageInfo) resolveSplitPackage(splitPkg *PackageInfo) *PackageInfo {
+	resolved := *splitPkg
+	source := reflect.ValueOf(pkgInfo).Elem()
+	target := reflect.ValueOf(&resolved).Elem()
+
+	for _, key := range splitPackageInheritedFields {
+		packageInfoField(target, key).Set(cloneValue(packageInfoField(source, key)))
+	}
+	for _, key := range splitPackageDefaultFields {
+		if field := packageInfoField(target, key); field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0) {
+			field.Set(cloneValue(packageInfoField(source, key)))
+		}
+	}
+	for _, key := range splitPackageSourceOnlyFields {
+		packageInfoField(target, key).SetZero()
+	}
+	resolved.Type = "binary"
+
+	return &resolved
+}
+
+// packageInfoField returns the field of a PackageInfo value with the given yaml key
+func packageInfoField(pkgInfo reflect.Value, key string) reflect.Value {
+	for i := 0; i < pkgInfo.NumField(); i++ {
+		if name, _, _ := strings.Cut(pkgInfo.Type().Field(i).Tag.Get("yaml"), ","); name == key {
+			return pkgInfo.Field(i)
+		}
+	}
+
+	panic(fmt.Sprintf("package info has no '%s' field", key))
+}
+
+// cloneValue returns a copy of value which does not share slice contents with it
+func cloneValue(value reflect.Value) reflect.Value {
+	if value.Kind() != reflect.Slice || value.IsNil() {
+		return value
+	}
+
+	clone := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+	reflect.Copy(clone, value)
+	return clone
+}
+
+func ReadPacakgeInfoFromTarball(path string) (*PackageInfo, error) {
+	// Read package archive
+	archive, err := ReadPackageArchive(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return pkgInfo, nil
+	return archive.PackageInfo, nil
 }
 
 func ReadPacakgeInfoFromFile(path string) (*PackageInfo, error) {
@@ -114,71 +204,145 @@ func ReadPacakgeInfoFromFile(path string) (*PackageInfo, error) {
 	return pkgInfo, nil
 }
 
-func (pkgDownload *PackageDownload) CalculateChecksum(pkgInfo *PackageInfo) (string, error) {
-	switch pkgDownload.Type {
-	case "", "file":
-		fmt.Println("Downloading and calculating checksum for file...")
-
-		// Replace variables in download url
-		downloadUrl := pkgDownload.Url
-		downloadUrl, err := envsubst.Eval(downloadUrl, func(s string) string {
-			switch s {
-			case "BPM_PKG_VERSION":
-				return pkgInfo.Version
-			case "BPM_PKG_NAME":
-				return pkgInfo.Name
-			default:
-				return ""
-			}
-		})
-		if err != nil {
-			return "", err
-		}
+type ChecksumOptions struct {
+	SourceCache      *SourceCache      // Cache downloaded files are stored in and reused from, may be nil
+	Jobs             int               // Amount of checksums to calculate concurrently. Defaults to 4
+	Variables        map[string]string // Additional substitution variables such as repository .env values
+	Arch             string            // Architecture whose override downloads are updated. All architectures if empty
+	PackageDirectory string            // Directory containing info.yml, required for local downloads
+}
 
-		cmd := exec.Command("sh", "-c", fmt.Sprintf("curl -s -L %s | sha256sum | awk '{print $1}'", downloadUrl))
-		cmd.Stderr = os.Stderr
+func (pkgDownload *PackageDownload) CalculateChecksum(pkgInfo *PackageInfo, options ChecksumOptions) (string, error) {
+	// Replace variables in download fields
+	variables, err := pkgInfo.SubstitutionVariables(options.Variables)
+	if err != nil {
+		return "", err
+	}
+	download, err := pkgDownload.Expand(variables)
+	if err != nil {
+		return "", err
+	}
 
-		checksum, err := cmd.Output()
-		if err != nil {
-			return "", err
-		}
+	downloadType, err := getDownloadType(download.Type)
+	if err != nil {
+		return "", err
+	}
+	if len(download.Mirrors) == 0 {
+		return downloadType.calculateChecksum(download, pkgDownload.Checksum, options)
+	}
 
-		return strings.TrimSpace(string(checksum)), err
-	case "git":
-		fmt.Println("Calculating checksum for git branch...")
-
-		// Replace variables in git branch
-		gitBranch := pkgDownload.GitBranch
-		gitBranch, err := envsubst.Eval(gitBranch, func(s string) string {
-			switch s {
-			case "BPM_PKG_VERSION":
-				return pkgInfo.Version
-			case "BPM_PKG_NAME":
-				return pkgInfo.Name
-			default:
-				return ""
-			}
-		})
+	// Use checksum of the first reachable url and ensure all other mirrors serve the same download
+	checksum, checksumUrl := "", ""
+	errs := make([]error, 0)
+	for _, url := range slices.Concat([]string{download.Url}, download.Mirrors) {
+		mirror := download
+		mirror.Url = url
+		mirrorChecksum, err := downloadType.calculateChecksum(mirror, pkgDownload.Checksum, options)
 		if err != nil {
-			return "", err
+			logger.Warnf("url (%s) is unreachable: %s", url, err)
+			errs = append(errs, fmt.Errorf("%s: %s", url, err))
+			continue
 		}
 
-		if pkgDownload.GitBranch == "" {
-			return "", fmt.Errorf("'git_branch' field cannot be empty")
+		if checksum == "" {
+			checksum, checksumUrl = mirrorChecksum, url
+		} else if mirrorChecksum != checksum {
+			logger.Warnf("url (%s) serves a different checksum than (%s)", url, checksumUrl)
 		}
+	}
+	if checksum == "" {
+		return "", fmt.Errorf("url and all mirrors are unreachable:\n%w", errors.Join(errs...))
+	}
 
-		cmd := exec.Command("sh", "-c", fmt.Sprintf("git ls-remote -bt %s | grep -E 'refs/.*/%s(\\^\\{\\})?$' | tail -n1 | awk '{print $1}'", pkgDownload.Url, gitBranch))
-		cmd.Stderr = os.Stderr
+	return checksum, nil
+}
 
-		checksum, err := cmd.Output()
-		if err != nil {
-			return "", err
+// UpdateDownloadChecksums recalculates the checksums of all downloads which are not set to 'skip', including
+// downloads of architecture overrides selected by options.Arch. Failures do not stop other downloads and are
+// returned together once all checksums have been calculated. Checksums which were calculated successfully are
+// applied even if others fail
+func (pkgInfo *PackageInfo) UpdateDownloadChecksums(options ChecksumOptions) error {
+	type downloadEntry struct {
+		download *PackageDownload
+		name     string
+		arch     string // Architecture of the override the download belongs to, empty for base downloads
+	}
+	entries := make([]downloadEntry, 0, len(pkgInfo.Downloads))
+	for i := range pkgInfo.Downloads {
+		entries = append(entries, downloadEntry{&pkgInfo.Downloads[i], fmt.Sprintf("download entry %d", i+1), ""})
+	}
+	archPkgInfos := make(map[string]*PackageInfo)
+	for _, arch := range slices.Sorted(maps.Keys(pkgInfo.ArchOverrides)) {
+		override := pkgInfo.ArchOverrides[arch]
+		if override == nil || (options.Arch != "" && options.Arch != arch) {
+			continue
+		}
+		for i := range override.Downloads {
+			entries = append(entries, downloadEntry{&override.Downloads[i], fmt.Sprintf("%s download entry %d", arch, i+1), arch})
 		}
 
-		return strings.TrimSpace(string(checksum)), err
-	default:
-		return "", fmt.Errorf("unknown download type (%s)", pkgDownload.Type)
+		// Expand variables of override downloads for the architecture of the override
+		archPkgInfo := pkgInfo.ForArch(arch)
+		archPkgInfo.Arch = arch
+		archPkgInfos[arch] = archPkgInfo
 	}
+	entries = slices.DeleteFunc(entries, func(entry downloadEntry) bool {
+		return entry.download.Checksum == "skip"
+	})
+
+	// Calculate checksums using a bounded worker pool
+	jobs := options.Jobs
+	if jobs <= 0 {
+		jobs = 4
+	}
+	checksums := make([]string, len(entries))
+	errs := make([]error, len(entries))
+	completed := 0
+	var mutex sync.Mutex
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobs, len(entries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				entryPkgInfo := pkgInfo
+				if entries[i].arch != "" {
+					entryPkgInfo = archPkgInfos[entries[i].arch]
+				}
+				checksums[i], errs[i] = entries[i].download.CalculateChecksum(entryPkgInfo, options)
+
+				mutex.Lock()
+				completed++
+				if errs[i] != nil {
+					logger.Infof("[%d/%d] Could not calculate checksum for %s", completed, len(entries), entries[i].name)
+				} else {
+					logger.Infof("[%d/%d] Calculated checksum for %s", completed, len(entries), entries[i].name)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i := range entries {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	// Apply checksums and collect failures in download order
+	failures := make([]error, 0)
+	for i, entry := range entries {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Errorf("%s (%s): %s", entry.name, entry.download.Url, errs[i]))
+			continue
+		}
+		entry.download.Checksum = checksums[i]
+	}
+	if len(failures) != 0 {
+		return fmt.Errorf("could not calculate %d of %d checksum(s):\n%w", len(failures), len(entries), errors.Join(failures...))
+	}
+
+	return nil
 }
 
 func CompareVersions(version1, version2 string) int {
@@ -188,61 +352,30 @@ func CompareVersions(version1, version2 string) int {
 	return v1.Compare(v2)
 }
 
+// SplitPkgNameAndVersion returns the name, first comparison operator and version of a dependency.
+//
+// Deprecated: use ParseDependency, which supports ranges, alternatives and architecture qualifiers
 func SplitPkgNameAndVersion(pkg string) (string, string, string) {
-	if strings.Contains(pkg, ">=") {
-		pkgSplit := strings.SplitN(pkg, ">=", 2)
-		pkgName := pkgSplit[0]
-		pkgVersion := pkgSplit[1]
-
-		return pkgName, ">=", pkgVersion
-	} else if strings.Contains(pkg, ">") {
-		pkgSplit := strings.SplitN(pkg, ">", 2)
-		pkgName := pkgSplit[0]
-		pkgVersion := pkgSplit[1]
-
-		return pkgName, ">", pkgVersion
-	} else if strings.Contains(pkg, "<=") {
-		pkgSplit := strings.SplitN(pkg, "<=", 2)
-		pkgName := pkgSplit[0]
-		pkgVersion := pkgSplit[1]
-
-		return pkgName, "<=", pkgVersion
-	} else if strings.Contains(pkg, "<") {
-		pkgSplit := strings.SplitN(pkg, "<", 2)
-		pkgName := pkgSplit[0]
-		pkgVersion := pkgSplit[1]
-
-		return pkgName, "<", pkgVersion
-	} else if strings.Contains(pkg, "=") {
-		pkgSplit := strings.SplitN(pkg, "=", 2)
-		pkgName := pkgSplit[0]
-		pkgVersion := pkgSplit[1]
-
-		return pkgName, "=", pkgVersion
+	dependency, err := ParseDependency(pkg)
+	if err != nil {
+		return pkg, "", ""
 	}
 
-	return pkg, "", ""
+	alternative := dependency.Alternatives[0]
+	if len(alternative.Constraints) == 0 {
+		return alternative.Name, "", ""
+	}
+	return alternative.Name, alternative.Constraints[0].Operator, alternative.Constraints[0].Version
 }
 
+// EvaluateDependency reports whether matchVersion satisfies the version constraints of the first alternative of a dependency.
+//
+// Deprecated: use ParseDependency and Dependency.Matches
 func EvaluateDependency(pkg, matchVersion string) bool {
-	_, comparisonSymbol, pkgVersion := SplitPkgNameAndVersion(pkg)
-
-	switch comparisonSymbol {
-	case ">=":
-		return CompareVersions(matchVersion, pkgVersion) >= 0
-	case ">":
-		return CompareVersions(matchVersion, pkgVersion) > 0
-	case "<=":
-		return CompareVersions(matchVersion, pkgVersion) <= 0
-	case "<":
-		return CompareVersions(matchVersion, pkgVersion) < 0
-	case "=":
-		if cutPkgVersion, ok := strings.CutSuffix(pkgVersion, "*"); ok {
-			return strings.HasPrefix(matchVersion, cutPkgVersion)
-		} else {
-			return CompareVersions(matchVersion, pkgVersion) == 0
-		}
-	default:
+	dependency, err := ParseDependency(pkg)
+	if err != nil {
 		return true
 	}
+
+	return dependency.Alternatives[0].MatchesVersion(matchVersion)
 }
@@ -0,0 +1,105 @@
+package bpm_utils_shared
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveSplitPackages(t *testing.T) {
+	pkgInfo, err := ReadPackageInfo([]byte(`name: foo
+version: "1.2"
+epoch: 1
+revision: 3
+description: Foo
+url: https://example.com
+license: MIT
+maintainers: [Alice]
+architecture: x86_64
+type: source
+depends: [bar]
+downloads:
+  - url: https://example.com/foo.tar.gz
+split_packages:
+  - name: foo-doc
+    architecture: any
+    depends: [foo]
+  - name: foo-libs
+    description: Foo libraries
+    maintainers: [Bob]
+`))
+	if err != nil {
+		t.Fatalf("ReadPackageInfo() error = %s", err)
+	}
+
+	want := []*PackageInfo{
+		{
+			Name:        "foo-doc",
+			Description: "Foo",
+			Version:     "1.2",
+			Epoch:       1,
+			Revision:    3,
+			Url:         "https://example.com",
+			License:     "MIT",
+			Maintainers: []string{"Alice"},
+			Arch:        "any",
+			Type:        "binary",
+			Depends:     []string{"foo"},
+		},
+		{
+			Name:        "foo-libs",
+			Description: "Foo libraries",
+			Version:     "1.2",
+			Epoch:       1,
+			Revision:    3,
+			Url:         "https://example.com",
+			License:     "MIT",
+			Maintainers: []string{"Bob"},
+			Arch:        "x86_64",
+			Type:        "binary",
+		},
+	}
+	got := pkgInfo.ResolveSplitPackages()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveSplitPackages() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Ensure inherited lists are not shared with the source package
+	got[0].Maintainers[0] = "Carol"
+	if pkgInfo.Maintainers[0] != "Alice" {
+		t.Errorf("source package maintainers changed to %v", pkgInfo.Maintainers)
+	}
+}
+
+func TestValidateSplitPackages(t *testing.T) {
+	pkgInfo, err := ReadPackageInfo([]byte(`name: foo
+version: "1.2"
+architecture: x86_64
+type: source
+split_packages:
+  - name: foo-doc
+  - name: foo-libs
+    version: "1.3"
+    type: source
+    downloads:
+      - url: https://example.com/foo.tar.gz
+    split_packages: []
+`))
+	if err != nil {
+		t.Fatalf("ReadPackageInfo() error = %s", err)
+	}
+
+	fields := make([]string, 0)
+	for _, validationError := range pkgInfo.Validate() {
+		fields = append(fields, validationError.Field)
+	}
+	want := []string{
+		"split_packages[1].version",
+		"split_packages[1].type",
+		"split_packages[1].downloads",
+		"split_packages[1].split_packages",
+	}
+	if strings.Join(fields, " ") != strings.Join(want, " ") {
+		t.Errorf("Validate() reported fields %v, want %v", fields, want)
+	}
+}
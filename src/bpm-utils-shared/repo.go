@@ -3,15 +3,39 @@ package bpm_utils_shared
 import (
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
+
+	"gopkg.in/yaml.v3"
 )
 
+type RepositoryConfig struct {
+	Name            string   `yaml:"name"`
+	Description     string   `yaml:"description"`
+	DatabaseSHA512  bool     `yaml:"database_sha512,omitempty"`
+	KeepAllVersions bool     `yaml:"keep_all_versions,omitempty"`
+	DatabaseFormats []string `yaml:"database_formats,omitempty"`
+	FilesIndex      bool     `yaml:"files_index,omitempty"`
+	SignDatabases   bool     `yaml:"sign_databases,omitempty"`
+	SigningKey      string   `yaml:"signing_key,omitempty"`
+}
+
 func GetRepository() string {
 	dir, err := os.Getwd()
 	if err != nil {
 		return ""
 	}
 
+	return FindRepository(dir)
+}
+
+// FindRepository returns the repository containing dir, or an empty string if dir is not inside a repository
+func FindRepository(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
 	for dir != "/" {
 		if _, err := os.Stat(path.Join(dir, "bpm-repo.conf")); err == nil {
 			return dir
@@ -25,11 +49,28 @@ func GetRepository() string {
 	return dir
 }
 
-func ReadRepositoryRecipes(repository string) []PackageInfo {
+func ReadRepositoryConfig(repository string) (*RepositoryConfig, error) {
+	data, err := os.ReadFile(path.Join(repository, "bpm-repo.conf"))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &RepositoryConfig{}
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func ReadRepositoryRecipes(repository string) ([]PackageInfo, error) {
 	// Read package recipes
 	recipeDirs, err := os.ReadDir(path.Join(repository, "recipes"))
-	if err != nil {
-		return nil
+	if os.IsNotExist(err) {
+		return make([]PackageInfo, 0), nil
+	} else if err != nil {
+		return nil, err
 	}
 
 	pkgs := make([]PackageInfo, 0)
@@ -40,9 +81,11 @@ func ReadRepositoryRecipes(repository string) []PackageInfo {
 		}
 
 		pkgInfo, err := ReadPacakgeInfoFromFile(pkgInfoPath)
-		if err == nil {
-			pkgs = append(pkgs, *pkgInfo)
+		if err != nil {
+			logger.Warnf("could not read package recipe (%s): %s", dir.Name(), err)
+			continue
 		}
+		pkgs = append(pkgs, *pkgInfo)
 	}
 
 	// Sort package recipes
@@ -50,5 +93,5 @@ func ReadRepositoryRecipes(repository string) []PackageInfo {
 		return pkgs[i].Name < pkgs[j].Name
 	})
 
-	return pkgs
+	return pkgs, nil
 }
@@ -0,0 +1,247 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type RepositoryProblemKind string
+
+const (
+	ProblemMissingArchive        RepositoryProblemKind = "missing-archive"
+	ProblemUnindexedArchive      RepositoryProblemKind = "unindexed-archive"
+	ProblemSizeMismatch          RepositoryProblemKind = "size-mismatch"
+	ProblemOrphanedSignature     RepositoryProblemKind = "orphaned-signature"
+	ProblemMissingSourcePackage  RepositoryProblemKind = "missing-source-package"
+	ProblemMissingRecipe         RepositoryProblemKind = "missing-recipe"
+	ProblemUnsatisfiedDependency RepositoryProblemKind = "unsatisfied-dependency"
+)
+
+type RepositoryProblem struct {
+	Kind      RepositoryProblemKind
+	Directory string // Repository subdirectory the problem was found in
+	Filepath  string // Path relative to the repository subdirectory
+	Package   string
+	Message   string
+}
+
+func (problem RepositoryProblem) Fixable() bool {
+	switch problem.Kind {
+	case ProblemMissingArchive, ProblemUnindexedArchive, ProblemSizeMismatch, ProblemOrphanedSignature:
+		return true
+	default:
+		return false
+	}
+}
+
+func CheckRepository(repo string) ([]RepositoryProblem, error) {
+	problems := make([]RepositoryProblem, 0)
+	databases := make(map[string]*BPMDatabase)
+
+	for _, dir := range []string{"source", "binary"} {
+		dirPath := path.Join(repo, dir)
+		if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+			continue
+		}
+
+		// Read database
+		database := &BPMDatabase{Entries: make(map[string]BPMDatabaseEntry)}
+		if _, err := os.Stat(path.Join(dirPath, "database.bpmdb")); err == nil {
+			database, err = ReadDatabase(path.Join(dirPath, "database.bpmdb"))
+			if err != nil {
+				return nil, fmt.Errorf("could not read %s database: %s", dir, err)
+			}
+		}
+		databases[dir] = database
+
+		// Collect all indexed package archives
+		indexed := make(map[string]BPMDatabaseEntry)
+		for name := range database.Entries {
+			for _, entry := range database.GetVersions(name) {
+				indexed[entry.Filepath] = entry
+			}
+		}
+
+		// Find package archives and signatures on disk
+		archives := make([]string, 0)
+		signatures := make([]string, 0)
+		err := filepath.Walk(dirPath, func(filePath string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			relPath, err := filepath.Rel(dirPath, filePath)
+			if err != nil {
+				return err
+			}
+
+			if strings.HasSuffix(relPath, ".bpm") {
+				archives = append(archives, relPath)
+			} else if strings.HasSuffix(relPath, ".bpm.sig") {
+				signatures = append(signatures, relPath)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Check database entries against files on disk
+		for _, relPath := range slices.Sorted(maps.Keys(indexed)) {
+			entry := indexed[relPath]
+			stat, err := os.Stat(path.Join(dirPath, relPath))
+			if err != nil {
+				problems = append(problems, RepositoryProblem{
+					Kind:      ProblemMissingArchive,
+					Directory: dir,
+					Filepath:  relPath,
+					Package:   entry.PackageInfo.Name,
+					Message:   fmt.Sprintf("package archive (%s) referenced by %s database does not exist", relPath, dir),
+				})
+			} else if stat.Size() != entry.DownloadSize {
+				problems = append(problems, RepositoryProblem{
+					Kind:      ProblemSizeMismatch,
+					Directory: dir,
+					Filepath:  relPath,
+					Package:   entry.PackageInfo.Name,
+					Message:   fmt.Sprintf("package archive (%s) is %d bytes but %s database expects %d bytes", relPath, stat.Size(), dir, entry.DownloadSize),
+				})
+			}
+		}
+
+		// Check files on disk against database entries
+		for _, relPath := range archives {
+			if _, ok := indexed[relPath]; !ok {
+				problems = append(problems, RepositoryProblem{
+					Kind:      ProblemUnindexedArchive,
+					Directory: dir,
+					Filepath:  relPath,
+					Message:   fmt.Sprintf("package archive (%s) is not in %s database", relPath, dir),
+				})
+			}
+		}
+		for _, relPath := range signatures {
+			if !slices.Contains(archives, strings.TrimSuffix(relPath, ".sig")) {
+				problems = append(problems, RepositoryProblem{
+					Kind:      ProblemOrphanedSignature,
+					Directory: dir,
+					Filepath:  relPath,
+					Message:   fmt.Sprintf("signature (%s) has no package archive", relPath),
+				})
+			}
+		}
+	}
+
+	// Check dependencies of binary packages which are provided by the repository itself
+	if binaryDatabase, ok := databases["binary"]; ok {
+		for _, name := range slices.Sorted(maps.Keys(binaryDatabase.Entries)) {
+			entry := binaryDatabase.Entries[name]
+			for _, depend := range slices.Concat(entry.PackageInfo.Depends, entry.PackageInfo.RuntimeDepends) {
+				dependency, err := ParseDependency(depend)
+				if err != nil || isDependencySatisfied(binaryDatabase, dependency) {
+					continue
+				}
+				problems = append(problems, RepositoryProblem{
+					Kind:      ProblemUnsatisfiedDependency,
+					Directory: "binary",
+					Filepath:  entry.Filepath,
+					Package:   name,
+					Message:   fmt.Sprintf("binary package (%s) depends on (%s) but no matching version is in binary database", name, depend),
+				})
+			}
+		}
+	}
+
+	// Check binary packages against source packages
+	if sourceDatabase, ok := databases["source"]; ok {
+		if binaryDatabase, ok := databases["binary"]; ok {
+			for _, name := range slices.Sorted(maps.Keys(binaryDatabase.Entries)) {
+				if findSourceEntry(sourceDatabase, name) == nil {
+					problems = append(problems, RepositoryProblem{
+						Kind:      ProblemMissingSourcePackage,
+						Directory: "binary",
+						Filepath:  binaryDatabase.Entries[name].Filepath,
+						Package:   name,
+						Message:   fmt.Sprintf("binary package (%s) has no source package", name),
+					})
+				}
+			}
+		}
+
+		// Check source packages against recipes
+		if _, err := os.Stat(path.Join(repo, "recipes")); err == nil {
+			recipes, err := ReadRepositoryRecipes(repo)
+			if err != nil {
+				return nil, fmt.Errorf("could not read package recipes: %s", err)
+			}
+			for _, name := range slices.Sorted(maps.Keys(sourceDatabase.Entries)) {
+				if !slices.ContainsFunc(recipes, func(recipe PackageInfo) bool { return recipe.Name == name }) {
+					problems = append(problems, RepositoryProblem{
+						Kind:      ProblemMissingRecipe,
+						Directory: "source",
+						Filepath:  sourceDatabase.Entries[name].Filepath,
+						Package:   name,
+						Message:   fmt.Sprintf("source package (%s) has no recipe", name),
+					})
+				}
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+func findSourceEntry(sourceDatabase *BPMDatabase, pkgName string) *BPMDatabaseEntry {
+	if entry, ok := sourceDatabase.Entries[pkgName]; ok {
+		return &entry
+	}
+
+	// Search for source package providing split package
+	for _, entry := range sourceDatabase.Entries {
+		for _, splitPkg := range entry.PackageInfo.ResolveSplitPackages() {
+			if splitPkg.Name == pkgName {
+				return &entry
+			}
+		}
+	}
+
+	return nil
+}
+
+// isDependencySatisfied reports whether a dependency may be satisfied. Alternatives naming packages which are
+// not in the database are assumed to be satisfied by other repositories
+func isDependencySatisfied(database *BPMDatabase, dependency Dependency) bool {
+	for _, alternative := range dependency.Alternatives {
+		found := false
+		for _, entry := range database.Entries {
+			if slices.ContainsFunc(entry.PackageInfo.Provides, func(provided string) bool {
+				providedName, _, _ := strings.Cut(provided, "=")
+				return providedName == alternative.Name
+			}) {
+				return true
+			}
+
+			for _, version := range database.GetVersions(entry.PackageInfo.Name) {
+				if version.PackageInfo.Name != alternative.Name {
+					continue
+				}
+				found = true
+				if alternative.Matches(version.PackageInfo.Name, version.PackageInfo.GetFullVersion(), version.PackageInfo.Arch) {
+					return true
+				}
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,53 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func SignFile(path, key string) error {
+	// Reserve temporary signature file in the same directory
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".sig.tmp-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	// Setup gpg command
+	args := []string{"--yes", "--output", file.Name(), "--detach-sign"}
+	if key != "" {
+		args = append(args, "--local-user", key)
+	}
+	args = append(args, path)
+
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdout = CommandStdout
+	cmd.Stderr = CommandStderr
+	cmd.Stdin = CommandStdin
+
+	err = cmd.Run()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(file.Name(), 0644)
+	if err != nil {
+		return err
+	}
+
+	// Move signature into place
+	return os.Rename(file.Name(), path+".sig")
+}
+
+func VerifySignature(path, signaturePath string) error {
+	cmd := exec.Command("gpg", "--verify", signaturePath, path)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
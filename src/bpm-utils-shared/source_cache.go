@@ -0,0 +1,212 @@
+package bpm_utils_shared
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SourceCache is a content-addressed store of downloaded package sources. Files are stored as
+// 'objects/<sha256 digest>' and 'urls/<sha256 of url>' files map download urls to object digests
+type SourceCache struct {
+	Directory string
+	MaxSize   int64 // Maximum size of all objects in bytes, 0 for no limit
+}
+
+// SourceCacheEnv is the environment variable through which the source cache directory is passed to 'bpm compile'
+const SourceCacheEnv = "BPM_SOURCE_CACHE"
+
+// OpenSourceCache opens the source cache configured in the BPM utils config, or returns nil if it is disabled
+func (config *BPMUtilsConfig) OpenSourceCache() (*SourceCache, error) {
+	if config.SourceCacheDir == "" {
+		return nil, nil
+	}
+
+	return OpenSourceCache(os.ExpandEnv(config.SourceCacheDir), config.SourceCacheMaxSize*1024*1024)
+}
+
+func OpenSourceCache(directory string, maxSize int64) (*SourceCache, error) {
+	for _, dir := range []string{"objects", "urls"} {
+		err := os.MkdirAll(filepath.Join(directory, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &SourceCache{Directory: directory, MaxSize: maxSize}, nil
+}
+
+func (cache *SourceCache) objectPath(digest string) string {
+	return filepath.Join(cache.Directory, "objects", digest)
+}
+
+func (cache *SourceCache) urlPath(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(cache.Directory, "urls", hex.EncodeToString(hash[:]))
+}
+
+// Lookup returns the path of the cached file downloaded from url
+func (cache *SourceCache) Lookup(url string) (string, bool) {
+	data, err := os.ReadFile(cache.urlPath(url))
+	if err != nil {
+		return "", false
+	}
+
+	objectPath := cache.objectPath(strings.TrimSpace(string(data)))
+	if _, err := os.Stat(objectPath); err != nil {
+		return "", false
+	}
+
+	// Mark object as recently used
+	now := time.Now()
+	os.Chtimes(objectPath, now, now)
+
+	return objectPath, true
+}
+
+// Store adds the contents of reader to the cache as the file downloaded from url and returns its path
+func (cache *SourceCache) Store(url string, reader io.Reader) (string, error) {
+	tempFile, err := os.CreateTemp(filepath.Join(cache.Directory, "objects"), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	// Write object while hashing its contents
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tempFile, hash), reader)
+	if err != nil {
+		return "", err
+	}
+	err = tempFile.Close()
+	if err != nil {
+		return "", err
+	}
+	err = os.Chmod(tempFile.Name(), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	objectPath := cache.objectPath(digest)
+	err = os.Rename(tempFile.Name(), objectPath)
+	if err != nil {
+		return "", err
+	}
+
+	err = WriteFileAtomic(cache.urlPath(url), []byte(digest+"\n"), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return objectPath, nil
+}
+
+// Fetch returns the path of the cached file downloaded from url, downloading it if it is not cached yet
+func (cache *SourceCache) Fetch(url string) (string, error) {
+	if objectPath, ok := cache.Lookup(url); ok {
+		return objectPath, nil
+	}
+
+	return cache.Download(url)
+}
+
+// Download downloads url into the cache, replacing the file previously cached for it, and returns its path
+func (cache *SourceCache) Download(url string) (string, error) {
+	var objectPath string
+	err := DownloadURL(url, func(reader io.Reader) (err error) {
+		objectPath, err = cache.Store(url, reader)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return objectPath, nil
+}
+
+// Prune removes least recently used objects until the cache fits its maximum size, as well as url entries
+// pointing to removed objects. If all is set every object is removed. Returns the amount of removed objects and bytes
+func (cache *SourceCache) Prune(all bool) (int, int64, error) {
+	type object struct {
+		digest  string
+		size    int64
+		modTime time.Time
+	}
+
+	// Read objects
+	entries, err := os.ReadDir(filepath.Join(cache.Directory, "objects"))
+	if err != nil {
+		return 0, 0, err
+	}
+	objects := make([]object, 0, len(entries))
+	totalSize := int64(0)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		// Remove temporary files left behind by interrupted downloads
+		if strings.HasPrefix(entry.Name(), ".") {
+			if time.Since(info.ModTime()) > 24*time.Hour {
+				os.Remove(filepath.Join(cache.Directory, "objects", entry.Name()))
+			}
+			continue
+		}
+		objects = append(objects, object{digest: entry.Name(), size: info.Size(), modTime: info.ModTime()})
+		totalSize += info.Size()
+	}
+
+	// Remove least recently used objects first
+	slices.SortFunc(objects, func(a, b object) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	removedObjects := 0
+	removedSize := int64(0)
+	for _, object := range objects {
+		if !all && (cache.MaxSize <= 0 || totalSize <= cache.MaxSize) {
+			break
+		}
+
+		err := os.Remove(cache.objectPath(object.digest))
+		if err != nil {
+			return removedObjects, removedSize, err
+		}
+		totalSize -= object.size
+		removedObjects++
+		removedSize += object.size
+	}
+
+	// Remove dangling url entries
+	entries, err = os.ReadDir(filepath.Join(cache.Directory, "urls"))
+	if err != nil {
+		return removedObjects, removedSize, err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		urlPath := filepath.Join(cache.Directory, "urls", entry.Name())
+		data, err := os.ReadFile(urlPath)
+		if err == nil {
+			if _, err := os.Stat(cache.objectPath(strings.TrimSpace(string(data)))); err == nil {
+				continue
+			}
+		}
+
+		err = os.Remove(urlPath)
+		if err != nil {
+			return removedObjects, removedSize, fmt.Errorf("could not remove url entry: %s", err)
+		}
+	}
+
+	return removedObjects, removedSize, nil
+}
@@ -0,0 +1,359 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KnownArchitectures lists the values accepted in 'architecture' and 'output_architecture' fields
+var KnownArchitectures = []string{"any", "x86_64", "aarch64", "i686", "armv7", "riscv64"}
+
+var packageNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._+-]*$`)
+var packageVersionRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._+~]*$`)
+
+type ValidationError struct {
+	Line    int // Line in info.yml, 0 if unknown
+	Field   string
+	Message string
+}
+
+func (validationError ValidationError) Error() string {
+	if validationError.Line == 0 {
+		return fmt.Sprintf("%s: %s", validationError.Field, validationError.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", validationError.Line, validationError.Field, validationError.Message)
+}
+
+// Validate checks package info for unknown fields, invalid names, versions and architectures and malformed
+// dependencies. Line numbers are only available if the package info was read using ReadPackageInfo
+func (pkgInfo *PackageInfo) Validate() []ValidationError {
+	validationErrors := validatePackageInfo(pkgInfo, pkgInfo.node, "", false)
+
+	// Sort errors by line
+	slices.SortStableFunc(validationErrors, func(a, b ValidationError) int {
+		return a.Line - b.Line
+	})
+
+	return validationErrors
+}
+
+func validatePackageInfo(pkgInfo *PackageInfo, node *yaml.Node, prefix string, splitPackage bool) []ValidationError {
+	validationErrors := make([]ValidationError, 0)
+	addError := func(key string, line int, format string, args ...any) {
+		validationErrors = append(validationErrors, ValidationError{
+			Line:    line,
+			Field:   prefix + key,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Check for unknown fields
+	validationErrors = append(validationErrors, validateKeys(node, reflect.TypeOf(PackageInfo{}), prefix)...)
+
+	// Check name
+	if pkgInfo.Name == "" {
+		addError("name", nodeLine(node, "name"), "package name cannot be empty")
+	} else if !packageNameRegex.MatchString(pkgInfo.Name) {
+		addError("name", nodeLine(node, "name"), "invalid package name (%s)", pkgInfo.Name)
+	}
+
+	// Check version, epoch and revision. Split packages always inherit them from their source package
+	if splitPackage {
+		for _, key := range splitPackageInheritedFields {
+			if hasKey(node, key) {
+				addError(key, nodeLine(node, key), "field is inherited from the source package and cannot be set")
+			}
+		}
+		for _, key := range splitPackageSourceOnlyFields {
+			if hasKey(node, key) {
+				addError(key, nodeLine(node, key), "field only applies to the source package")
+			}
+		}
+	} else {
+		if pkgInfo.Version == "" {
+			addError("version", nodeLine(node, "version"), "package version cannot be empty")
+		} else if !packageVersionRegex.MatchString(pkgInfo.Version) {
+			addError("version", nodeLine(node, "version"), "invalid package version (%s)", pkgInfo.Version)
+		}
+		if pkgInfo.Epoch < 0 {
+			addError("epoch", nodeLine(node, "epoch"), "package epoch cannot be negative")
+		}
+		if pkgInfo.Revision < 1 {
+			addError("revision", nodeLine(node, "revision"), "package revision must be 1 or greater")
+		}
+	}
+
+	// Check type
+	switch pkgInfo.Type {
+	case "source", "binary":
+	case "":
+		addError("type", nodeLine(node, "type"), "package type cannot be empty")
+	default:
+		addError("type", nodeLine(node, "type"), "unknown package type (%s)", pkgInfo.Type)
+	}
+
+	// Check architectures. Architectures inherited by split packages are checked in the source package
+	if !splitPackage || hasKey(node, "architecture") {
+		if pkgInfo.Arch == "" {
+			addError("architecture", nodeLine(node, "architecture"), "package architecture cannot be empty")
+		} else if !slices.Contains(KnownArchitectures, pkgInfo.Arch) {
+			addError("architecture", nodeLine(node, "architecture"), "unknown architecture (%s)", pkgInfo.Arch)
+		}
+	}
+	if (!splitPackage || hasKey(node, "output_architecture")) && pkgInfo.OutputArch != "" && !slices.Contains(KnownArchitectures, pkgInfo.OutputArch) {
+		addError("output_architecture", nodeLine(node, "output_architecture"), "unknown architecture (%s)", pkgInfo.OutputArch)
+	}
+
+	// Check dependency lists
+	validationErrors = append(validationErrors, validateDependencyLists([]dependencyList{
+		{"depends", pkgInfo.Depends},
+		{"runtime_depends", pkgInfo.RuntimeDepends},
+		{"optional_depends", pkgInfo.OptionalDepends},
+		{"make_depends", pkgInfo.MakeDepends},
+		{"check_depends", pkgInfo.CheckDepends},
+		{"conflicts", pkgInfo.Conflicts},
+		{"replaces", pkgInfo.Replaces},
+		{"provides", pkgInfo.Provides},
+	}, node, prefix)...)
+
+	// Check user variables
+	for name := range pkgInfo.Variables {
+		if !variableNameRegex.MatchString(name) {
+			addError("variables."+name, nodeLine(mappingValue(node, "variables"), name), "invalid variable name")
+		} else if strings.HasPrefix(name, "BPM_") {
+			addError("variables."+name, nodeLine(mappingValue(node, "variables"), name), "variable names starting with 'BPM_' are reserved")
+		}
+	}
+
+	// Check downloads
+	validationErrors = append(validationErrors, validateDownloads(pkgInfo.Downloads, node, prefix)...)
+
+	// Check architecture overrides
+	overridesNode := mappingValue(node, "arch_overrides")
+	for _, arch := range slices.Sorted(maps.Keys(pkgInfo.ArchOverrides)) {
+		override := pkgInfo.ArchOverrides[arch]
+		overrideNode := mappingValue(overridesNode, arch)
+		overridePrefix := fmt.Sprintf("%sarch_overrides.%s.", prefix, arch)
+		if arch == "any" || !slices.Contains(KnownArchitectures, arch) {
+			addError("arch_overrides."+arch, nodeLine(overridesNode, arch), "unknown architecture (%s)", arch)
+		}
+		if override == nil {
+			continue
+		}
+
+		validationErrors = append(validationErrors, validateKeys(overrideNode, reflect.TypeOf(ArchOverride{}), overridePrefix)...)
+		validationErrors = append(validationErrors, validateDependencyLists([]dependencyList{
+			{"depends", override.Depends},
+			{"runtime_depends", override.RuntimeDepends},
+			{"optional_depends", override.OptionalDepends},
+			{"make_depends", override.MakeDepends},
+			{"check_depends", override.CheckDepends},
+			{"conflicts", override.Conflicts},
+			{"replaces", override.Replaces},
+			{"provides", override.Provides},
+		}, overrideNode, overridePrefix)...)
+		if splitPackage && hasKey(overrideNode, "downloads") {
+			addError("arch_overrides."+arch+".downloads", nodeLine(overrideNode, "downloads"), "field only applies to the source package")
+		} else {
+			validationErrors = append(validationErrors, validateDownloads(override.Downloads, overrideNode, overridePrefix)...)
+		}
+	}
+
+	// Check split packages with inherited fields resolved
+	names := []string{pkgInfo.Name}
+	for i, splitPkg := range pkgInfo.SplitPackages {
+		if splitPkg == nil {
+			continue
+		}
+		splitNode := itemNode(node, "split_packages", i)
+		splitPrefix := fmt.Sprintf("%ssplit_packages[%d].", prefix, i)
+		if splitPkg.Type != "" && splitPkg.Type != "binary" {
+			addError(fmt.Sprintf("split_packages[%d].type", i), nodeLine(splitNode, "type"), "split packages are always binary packages")
+		}
+		validationErrors = append(validationErrors, validatePackageInfo(pkgInfo.resolveSplitPackage(splitPkg), splitNode, splitPrefix, true)...)
+
+		if splitPkg.Name != "" && slices.Contains(names, splitPkg.Name) {
+			addError(fmt.Sprintf("split_packages[%d].name", i), nodeLine(splitNode, "name"), "duplicate package name (%s)", splitPkg.Name)
+		}
+		names = append(names, splitPkg.Name)
+	}
+
+	return validationErrors
+}
+
+type dependencyList struct {
+	key          string
+	dependencies []string
+}
+
+func validateDependencyLists(lists []dependencyList, node *yaml.Node, prefix string) []ValidationError {
+	validationErrors := make([]ValidationError, 0)
+	for _, list := range lists {
+		for i, dependency := range list.dependencies {
+			if err := validateDependency(dependency, list.key); err != nil {
+				validationErrors = append(validationErrors, ValidationError{
+					Line:    itemLine(node, list.key, i),
+					Field:   fmt.Sprintf("%s%s[%d]", prefix, list.key, i),
+					Message: err.Error(),
+				})
+			}
+		}
+	}
+
+	return validationErrors
+}
+
+func validateDownloads(downloads []PackageDownload, node *yaml.Node, prefix string) []ValidationError {
+	validationErrors := make([]ValidationError, 0)
+	for i, download := range downloads {
+		downloadNode := itemNode(node, "downloads", i)
+		downloadPrefix := fmt.Sprintf("%sdownloads[%d].", prefix, i)
+		addError := func(key string, format string, args ...any) {
+			validationErrors = append(validationErrors, ValidationError{
+				Line:    nodeLine(downloadNode, key),
+				Field:   downloadPrefix + key,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+		validationErrors = append(validationErrors, validateKeys(downloadNode, reflect.TypeOf(PackageDownload{}), downloadPrefix)...)
+
+		if download.Url == "" {
+			addError("url", "download url cannot be empty")
+		}
+		for j, mirror := range download.Mirrors {
+			if download.Type == "local" {
+				addError("mirrors", "local downloads cannot have mirrors")
+				break
+			}
+			if mirror == "" {
+				validationErrors = append(validationErrors, ValidationError{
+					Line:    itemLine(downloadNode, "mirrors", j),
+					Field:   fmt.Sprintf("%smirrors[%d]", downloadPrefix, j),
+					Message: "mirror url cannot be empty",
+				})
+			}
+		}
+		if downloadType, err := getDownloadType(download.Type); err != nil {
+			addError("type", "%s", err)
+		} else if field, err := downloadType.validate(download); err != nil {
+			addError(field, "%s", err)
+		}
+		switch download.Type {
+		case "", "file", "local":
+			// Version control downloads are pinned to revisions rather than file checksums
+			if !isPlaceholderChecksum(download.Checksum) {
+				if _, err := ParseChecksum(download.Checksum); err != nil {
+					addError("checksum", "%s", err)
+				}
+			}
+		}
+	}
+
+	return validationErrors
+}
+
+func validateDependency(dependency, key string) error {
+	parsed, err := ParseDependency(dependency)
+	if err != nil {
+		return err
+	}
+
+	for _, alternative := range parsed.Alternatives {
+		if alternative.Arch != "" && !slices.Contains(KnownArchitectures, alternative.Arch) {
+			return fmt.Errorf("unknown architecture (%s) in dependency (%s)", alternative.Arch, dependency)
+		}
+	}
+
+	// Alternatives and ranges only make sense for dependencies
+	switch key {
+	case "conflicts", "replaces", "provides":
+		if len(parsed.Alternatives) > 1 {
+			return fmt.Errorf("'%s' entries cannot have alternatives (%s)", key, dependency)
+		}
+	}
+	if key == "provides" {
+		constraints := parsed.Alternatives[0].Constraints
+		if len(constraints) > 1 || (len(constraints) == 1 && constraints[0].Operator != "=") {
+			return fmt.Errorf("provided packages may only specify an exact version (%s)", dependency)
+		}
+	}
+
+	return nil
+}
+
+// validateKeys reports keys of a mapping node which do not correspond to a yaml field of the given struct type
+func validateKeys(node *yaml.Node, structType reflect.Type, prefix string) []ValidationError {
+	validationErrors := make([]ValidationError, 0)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return validationErrors
+	}
+
+	knownKeys := make([]string, 0)
+	for i := 0; i < structType.NumField(); i++ {
+		key, _, _ := strings.Cut(structType.Field(i).Tag.Get("yaml"), ",")
+		if key != "" && key != "-" {
+			knownKeys = append(knownKeys, key)
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode := node.Content[i]
+		if !slices.Contains(knownKeys, keyNode.Value) {
+			validationErrors = append(validationErrors, ValidationError{
+				Line:    keyNode.Line,
+				Field:   prefix + keyNode.Value,
+				Message: "unknown field",
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func hasKey(node *yaml.Node, key string) bool {
+	return mappingValue(node, key) != nil
+}
+
+// nodeLine returns the line of the value of a key, falling back to the line of the mapping itself
+func nodeLine(node *yaml.Node, key string) int {
+	if value := mappingValue(node, key); value != nil {
+		return value.Line
+	}
+	if node != nil {
+		return node.Line
+	}
+	return 0
+}
+
+func itemNode(node *yaml.Node, key string, index int) *yaml.Node {
+	value := mappingValue(node, key)
+	if value == nil || value.Kind != yaml.SequenceNode || index >= len(value.Content) {
+		return nil
+	}
+	return value.Content[index]
+}
+
+func itemLine(node *yaml.Node, key string, index int) int {
+	if item := itemNode(node, key, index); item != nil {
+		return item.Line
+	}
+	return nodeLine(node, key)
+}
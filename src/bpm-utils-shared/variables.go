@@ -0,0 +1,154 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/drone/envsubst"
+)
+
+// CompileVariables are set by 'bpm compile' and are left unexpanded in download fields
+var CompileVariables = []string{"BPM_SOURCE", "BPM_OUTPUT"}
+
+var variableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ReadRepositoryEnv reads 'KEY=VALUE' lines from the .env file of a repository
+func ReadRepositoryEnv(repo string) (map[string]string, error) {
+	env := make(map[string]string)
+
+	data, err := os.ReadFile(path.Join(repo, ".env"))
+	if os.IsNotExist(err) {
+		return env, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !variableNameRegex.MatchString(key) {
+			return nil, fmt.Errorf(".env line %d: invalid format", i+1)
+		}
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// SubstitutionVariables returns the variables available in download fields. Built-in variables are:
+//   - BPM_PKG_NAME, BPM_PKG_VERSION, BPM_PKG_REVISION and BPM_PKG_ARCH
+//   - BPM_PKG_VERSION_MAJOR, BPM_PKG_VERSION_MINOR, BPM_PKG_VERSION_PATCH and BPM_PKG_VERSION_MAJOR_MINOR,
+//     for versions which have enough dot-separated components
+//
+// Variables declared under 'variables' in info.yml may use built-in and extra variables, and take precedence
+// over extra variables such as repository .env values. Built-in variables cannot be overridden
+func (pkgInfo *PackageInfo) SubstitutionVariables(extra map[string]string) (map[string]string, error) {
+	builtin := map[string]string{
+		"BPM_PKG_NAME":     pkgInfo.Name,
+		"BPM_PKG_VERSION":  pkgInfo.Version,
+		"BPM_PKG_REVISION": strconv.Itoa(pkgInfo.Revision),
+		"BPM_PKG_ARCH":     pkgInfo.Arch,
+	}
+	versionComponents := strings.Split(pkgInfo.Version, ".")
+	for i, name := range []string{"MAJOR", "MINOR", "PATCH"} {
+		if i < len(versionComponents) {
+			builtin["BPM_PKG_VERSION_"+name] = versionComponents[i]
+		}
+	}
+	if len(versionComponents) >= 2 {
+		builtin["BPM_PKG_VERSION_MAJOR_MINOR"] = versionComponents[0] + "." + versionComponents[1]
+	}
+
+	variables := maps.Clone(extra)
+	if variables == nil {
+		variables = make(map[string]string)
+	}
+	maps.Copy(variables, builtin)
+
+	// Expand user variables
+	userVariables := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(pkgInfo.Variables)) {
+		if _, ok := builtin[name]; ok {
+			return nil, fmt.Errorf("variable (%s) cannot be overridden", name)
+		}
+
+		value, err := ExpandVariables(pkgInfo.Variables[name], variables)
+		if err != nil {
+			return nil, fmt.Errorf("variable (%s): %s", name, err)
+		}
+		userVariables[name] = value
+	}
+	maps.Copy(variables, userVariables)
+
+	return variables, nil
+}
+
+// ExpandVariables replaces variable references in s. Compile variables are left as they are and referencing any
+// other undefined variable is an error
+func ExpandVariables(s string, variables map[string]string) (string, error) {
+	undefined := make([]string, 0)
+	expanded, err := envsubst.Eval(s, func(name string) string {
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		if slices.Contains(CompileVariables, name) {
+			return "${" + name + "}"
+		}
+		if !slices.Contains(undefined, name) {
+			undefined = append(undefined, name)
+		}
+		return ""
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(undefined) != 0 {
+		return "", fmt.Errorf("undefined variable(s): %s", strings.Join(undefined, ", "))
+	}
+
+	return expanded, nil
+}
+
+// Expand returns a copy of the download with variables in its urls, branches and paths expanded
+func (pkgDownload PackageDownload) Expand(variables map[string]string) (PackageDownload, error) {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"url", &pkgDownload.Url},
+		{"git_branch", &pkgDownload.GitBranch},
+		{"hg_branch", &pkgDownload.HgBranch},
+		{"filepath", &pkgDownload.Filepath},
+		{"extract_to", &pkgDownload.ExtractTo},
+		{"clone_to", &pkgDownload.CloneTo},
+	}
+	for _, field := range fields {
+		expanded, err := ExpandVariables(*field.value, variables)
+		if err != nil {
+			return PackageDownload{}, fmt.Errorf("'%s' field: %s", field.name, err)
+		}
+		*field.value = expanded
+	}
+
+	mirrors := make([]string, len(pkgDownload.Mirrors))
+	for i, mirror := range pkgDownload.Mirrors {
+		expanded, err := ExpandVariables(mirror, variables)
+		if err != nil {
+			return PackageDownload{}, fmt.Errorf("'mirrors' field: %s", err)
+		}
+		mirrors[i] = expanded
+	}
+	pkgDownload.Mirrors = mirrors
+
+	return pkgDownload, nil
+}
@@ -0,0 +1,106 @@
+package bpm_utils_shared
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FullVersion is a package version including its epoch and revision, formatted as '[epoch:]version[-revision]'.
+// The last '-' always separates the revision, as bare versions cannot contain '-'
+type FullVersion struct {
+	Epoch    int
+	Version  string
+	Revision int // 0 if the revision is not specified
+}
+
+func ParseFullVersion(fullVersion string) (FullVersion, error) {
+	parsed := FullVersion{Version: fullVersion}
+
+	// Parse epoch
+	if epoch, version, ok := strings.Cut(parsed.Version, ":"); ok {
+		epochInt, err := strconv.Atoi(epoch)
+		if err != nil || epochInt < 0 {
+			return FullVersion{}, fmt.Errorf("invalid epoch in version (%s)", fullVersion)
+		}
+		parsed.Epoch = epochInt
+		parsed.Version = version
+	}
+
+	// Parse revision
+	if index := strings.LastIndexByte(parsed.Version, '-'); index != -1 {
+		revision, err := strconv.Atoi(parsed.Version[index+1:])
+		if err != nil || revision < 1 {
+			return FullVersion{}, fmt.Errorf("invalid revision in version (%s)", fullVersion)
+		}
+		parsed.Revision = revision
+		parsed.Version = parsed.Version[:index]
+	}
+
+	if parsed.Version == "" {
+		return FullVersion{}, fmt.Errorf("version (%s) cannot be empty", fullVersion)
+	}
+	// Versions cannot contain '-', so dates like '2024-01-01' are rejected rather than read as version '2024-01'
+	// with revision 1. Such versions must be written as '2024.01.01'
+	if strings.Contains(parsed.Version, "-") {
+		return FullVersion{}, fmt.Errorf("version (%s) cannot contain '-' outside of the revision", fullVersion)
+	}
+
+	return parsed, nil
+}
+
+func (version FullVersion) String() string {
+	str := version.Version
+	if version.Epoch > 0 {
+		str = strconv.Itoa(version.Epoch) + ":" + str
+	}
+	if version.Revision > 0 {
+		str += "-" + strconv.Itoa(version.Revision)
+	}
+
+	return str
+}
+
+// Compare compares epochs, then versions, then revisions. Revisions are only compared if both are specified
+func (version FullVersion) Compare(other FullVersion) int {
+	if version.Epoch != other.Epoch {
+		if version.Epoch > other.Epoch {
+			return 1
+		}
+		return -1
+	}
+
+	if comparison := CompareVersions(version.Version, other.Version); comparison != 0 {
+		return comparison
+	}
+
+	if version.Revision == 0 || other.Revision == 0 || version.Revision == other.Revision {
+		return 0
+	} else if version.Revision > other.Revision {
+		return 1
+	}
+	return -1
+}
+
+// CompareFullVersions compares two versions formatted as '[epoch:]version[-revision]'. Versions which cannot be
+// parsed are compared as bare versions
+func CompareFullVersions(version1, version2 string) int {
+	v1, err := ParseFullVersion(version1)
+	if err != nil {
+		v1 = FullVersion{Version: version1}
+	}
+	v2, err := ParseFullVersion(version2)
+	if err != nil {
+		v2 = FullVersion{Version: version2}
+	}
+
+	return v1.Compare(v2)
+}
+
+func (pkgInfo *PackageInfo) GetVersionInfo() FullVersion {
+	return FullVersion{
+		Epoch:    pkgInfo.Epoch,
+		Version:  pkgInfo.Version,
+		Revision: pkgInfo.Revision,
+	}
+}
@@ -0,0 +1,98 @@
+package bpm_utils_shared
+
+import (
+	"testing"
+)
+
+func TestParseFullVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    FullVersion
+	}{
+		{"1.2", FullVersion{Version: "1.2"}},
+		{"1.2-3", FullVersion{Version: "1.2", Revision: 3}},
+		{"2:1.2", FullVersion{Epoch: 2, Version: "1.2"}},
+		{"2:1.2-3", FullVersion{Epoch: 2, Version: "1.2", Revision: 3}},
+		{"0:1.2-1", FullVersion{Version: "1.2", Revision: 1}},
+		{"1.2~rc1+git20240101-10", FullVersion{Version: "1.2~rc1+git20240101", Revision: 10}},
+		{"2024.01.01", FullVersion{Version: "2024.01.01"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			got, err := ParseFullVersion(test.version)
+			if err != nil {
+				t.Fatalf("ParseFullVersion() error = %s", err)
+			}
+			if got != test.want {
+				t.Errorf("ParseFullVersion() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFullVersionErrors(t *testing.T) {
+	for _, version := range []string{
+		"",
+		"-1",
+		"1:",
+		"x:1.2",
+		"-1:1.2",
+		"1.2-",
+		"1.2-0",
+		"1.2-x",
+		"1.2-rc1",
+		// Dates are not read as version '2024-01' with revision 1
+		"2024-01-01",
+		"1:2024-01-01-1",
+	} {
+		t.Run(version, func(t *testing.T) {
+			if got, err := ParseFullVersion(version); err == nil {
+				t.Errorf("ParseFullVersion() = %+v, want error", got)
+			}
+		})
+	}
+}
+
+func TestFullVersionString(t *testing.T) {
+	for _, version := range []string{"1.2", "1.2-3", "2:1.2", "2:1.2-3"} {
+		parsed, err := ParseFullVersion(version)
+		if err != nil {
+			t.Fatalf("ParseFullVersion(%s) error = %s", version, err)
+		}
+		if got := parsed.String(); got != version {
+			t.Errorf("String() = %s, want %s", got, version)
+		}
+	}
+}
+
+func TestCompareFullVersions(t *testing.T) {
+	tests := []struct {
+		version1, version2 string
+		want               int
+	}{
+		{"1.2", "1.2", 0},
+		{"1.2", "1.10", -1},
+		{"1.10", "1.2", 1},
+		{"1.2-1", "1.2-2", -1},
+		{"1.2-10", "1.2-2", 1},
+		{"1.2-3", "1.2-3", 0},
+		// Revisions are only compared if both versions specify one
+		{"1.2", "1.2-5", 0},
+		{"1.2-5", "1.2", 0},
+		{"1.3", "1.2-5", 1},
+		// Epochs take precedence over versions and revisions
+		{"1:1.0", "2.0", 1},
+		{"1.0-9", "1:0.1-1", -1},
+		{"0:1.2", "1.2", 0},
+		{"2:1.2-1", "1:1.2-1", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version1+" "+test.version2, func(t *testing.T) {
+			if got := CompareFullVersions(test.version1, test.version2); got != test.want {
+				t.Errorf("CompareFullVersions() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}